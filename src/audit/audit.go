@@ -0,0 +1,215 @@
+package audit
+
+import (
+	"errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/models"
+	"wild_project/src/my_prometheus"
+	"wild_project/src/repository"
+)
+
+var logger *log.Logger
+var filePath = "logs/audit.log"
+
+func init() {
+	logger = log.New(&lumberjack.Logger{
+		Filename:   filePath,
+		MaxSize:    10, // Размер файла в мегабайтах до ротации
+		MaxBackups: 3,  // Максимальное количество старых файлов логов
+		MaxAge:     28, // Максимальное количество дней для хранения логов
+		Compress:   true,
+	}, "AUDIT: ", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// Виды расхождений кэша с БД
+const (
+	KindStale     = "stale"         // Заказ в кэше отличается от заказа в БД
+	KindMissingDB = "missing_in_db" // Заказ есть в кэше, но удален из БД
+)
+
+// ErrRunning проверка уже выполняется
+var ErrRunning = errors.New("проверка кэша уже выполняется")
+
+// Options параметры проверки
+type Options struct {
+	Sample int  // Сколько случайных заказов кэша проверить, 0 - проверить все
+	Repair bool // Исправить расхождения: заменить заказ данными из БД или удалить его из кэша
+}
+
+// Divergence расхождение одного заказа
+type Divergence struct {
+	OrderUID string          `json:"order_uid"`
+	Kind     string          `json:"kind"`
+	Fields   []models.Change `json:"fields,omitempty"` // old - значение в кэше, new - в БД
+	Repaired bool            `json:"repaired"`
+}
+
+// Report итоги проверки
+type Report struct {
+	StartedAt   time.Time    `json:"started_at"`
+	Duration    string       `json:"duration"`
+	Cached      int          `json:"cached"`  // Заказов в кэше на начало проверки
+	Checked     int          `json:"checked"` // Заказов проверено
+	Repaired    int          `json:"repaired"`
+	Divergences []Divergence `json:"divergences"`
+}
+
+// Auditor сравнивает заказы в кэше с БД
+type Auditor struct {
+	cache cache.Cache
+	repo  repository.OrderRepository
+	mu    sync.Mutex // Одновременно выполняется одна проверка
+}
+
+// New создает проверку кэша orderCache по хранилищу repo
+func New(orderCache cache.Cache, repo repository.OrderRepository) *Auditor {
+	return &Auditor{cache: orderCache, repo: repo}
+}
+
+// Run проверяет заказы кэша. Возвращает ErrRunning, если проверка уже идет.
+func (a *Auditor) Run(opts Options) (Report, error) {
+	if !a.mu.TryLock() {
+		return Report{}, ErrRunning
+	}
+	defer a.mu.Unlock()
+
+	report := Report{StartedAt: time.Now(), Divergences: []Divergence{}}
+	uids := a.cache.Keys()
+	report.Cached = len(uids)
+	if opts.Sample > 0 && opts.Sample < len(uids) {
+		rand.Shuffle(len(uids), func(i, j int) { uids[i], uids[j] = uids[j], uids[i] })
+		uids = uids[:opts.Sample]
+	}
+
+	for start := 0; start < len(uids); start += repository.DefaultChunkSize {
+		end := start + repository.DefaultChunkSize
+		if end > len(uids) {
+			end = len(uids)
+		}
+		divergences, checked, err := a.check(uids[start:end])
+		if err != nil {
+			return report, err
+		}
+		report.Checked += checked
+		for _, d := range divergences {
+			// Заказ мог измениться во время проверки, расхождение подтверждается повторным чтением
+			d, confirmed, err := a.recheck(d.OrderUID)
+			if err != nil {
+				return report, err
+			}
+			if !confirmed {
+				continue
+			}
+			my_prometheus.AuditDivergences.WithLabelValues(d.Kind).Inc()
+			if opts.Repair && a.repair(&d) {
+				report.Repaired++
+			}
+			report.Divergences = append(report.Divergences, d)
+		}
+	}
+	my_prometheus.AuditChecked.Add(float64(report.Checked))
+	my_prometheus.AuditLastDivergences.Set(float64(len(report.Divergences)))
+	my_prometheus.AuditLastRun.SetToCurrentTime()
+	report.Duration = time.Since(report.StartedAt).String()
+	logger.Printf("Проверено заказов: %d из %d, расхождений: %d, исправлено: %d",
+		report.Checked, report.Cached, len(report.Divergences), report.Repaired)
+	return report, nil
+}
+
+// check сравнивает пачку заказов кэша с БД. Заказ читается из кэша до чтения из БД:
+// если между чтениями заказ обновится, кэш окажется старше БД, а не наоборот.
+func (a *Auditor) check(uids []string) ([]Divergence, int, error) {
+	cached := make(map[string]models.Order, len(uids))
+	for _, uid := range uids {
+		if order, exists := a.cache.Peek(uid); exists {
+			cached[uid] = order
+		}
+	}
+
+	stored, err := a.repo.GetByUIDs(uids)
+	if err != nil {
+		return nil, 0, err
+	}
+	byUID := make(map[string]models.Order, len(stored))
+	for _, order := range stored {
+		byUID[order.OrderUID] = order
+	}
+
+	var divergences []Divergence
+	for _, uid := range uids {
+		order, exists := cached[uid]
+		if !exists {
+			// Заказ вытеснен во время проверки
+			continue
+		}
+		if d, ok := compare(order, byUID[uid], uid); ok {
+			divergences = append(divergences, d)
+		}
+	}
+	return divergences, len(cached), nil
+}
+
+// recheck повторно сравнивает один заказ
+func (a *Auditor) recheck(uid string) (Divergence, bool, error) {
+	order, exists := a.cache.Peek(uid)
+	if !exists {
+		return Divergence{}, false, nil
+	}
+	stored, err := a.repo.GetByUID(uid)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return Divergence{}, false, err
+	}
+	d, ok := compare(order, stored, uid)
+	return d, ok, nil
+}
+
+// compare сравнивает заказ из кэша с заказом из БД, пустой stored - заказа в БД нет
+func compare(cached, stored models.Order, uid string) (Divergence, bool) {
+	if stored.OrderUID == "" {
+		return Divergence{OrderUID: uid, Kind: KindMissingDB}, true
+	}
+	if changes := models.Diff(cached, stored); len(changes) > 0 {
+		return Divergence{OrderUID: uid, Kind: KindStale, Fields: changes}, true
+	}
+	return Divergence{}, false
+}
+
+// repair приводит кэш в соответствие с БД
+func (a *Auditor) repair(d *Divergence) bool {
+	switch d.Kind {
+	case KindMissingDB:
+		a.cache.Remove(d.OrderUID)
+	case KindStale:
+		stored, err := a.repo.GetByUID(d.OrderUID)
+		if err != nil {
+			logger.Printf("Ошибка загрузки заказа %s для исправления: %v", d.OrderUID, err)
+			return false
+		}
+		a.cache.Add(stored)
+	}
+	d.Repaired = true
+	my_prometheus.AuditRepaired.Inc()
+	logger.Printf("Исправлено расхождение %s заказа %s", d.Kind, d.OrderUID)
+	return true
+}
+
+// RunPeriodically проверяет кэш каждые interval, пока не закрыт stop
+func (a *Auditor) RunPeriodically(interval time.Duration, opts Options, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := a.Run(opts); err != nil && !errors.Is(err, ErrRunning) {
+				logger.Printf("Ошибка проверки кэша: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"wild_project/src/cache"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+func TestAuditorRun(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	oc := cache.NewOrderCache()
+	for i := 0; i < 5; i++ {
+		order := models.Order{
+			OrderUID: fmt.Sprintf("order-%d", i),
+			Delivery: models.Delivery{City: "Kazan"},
+			Items:    []models.Items{{ChrtID: i, Status: 1}},
+		}
+		assert.NoError(db.Create(&order).Error)
+		oc.Add(order)
+	}
+	auditor := New(oc, repo)
+
+	report, err := auditor.Run(Options{})
+	assert.NoError(err)
+	assert.Equal(5, report.Checked)
+	assert.Empty(report.Divergences, "заказ, записанный при приеме, совпадает с прочитанным из БД")
+
+	// Заказ изменен в БД в обход кэша, другой удален из БД
+	var changedOrder models.Order
+	db.Where("order_uid = ?", "order-2").First(&changedOrder)
+	db.Model(&models.Delivery{}).Where("order_uid = ?", changedOrder.OrderUID).Update("city", "Moscow")
+	db.Where("order_uid = ?", "order-4").Delete(&models.Order{})
+
+	report, err = auditor.Run(Options{})
+	assert.NoError(err)
+	if assert.Len(report.Divergences, 2) {
+		for _, d := range report.Divergences {
+			assert.False(d.Repaired)
+			switch d.OrderUID {
+			case changedOrder.OrderUID:
+				assert.Equal(KindStale, d.Kind)
+				assert.Equal([]models.Change{{Path: "delivery.City", Old: "Kazan", New: "Moscow"}}, d.Fields)
+			case "order-4":
+				assert.Equal(KindMissingDB, d.Kind)
+			default:
+				t.Errorf("лишнее расхождение: %+v", d)
+			}
+		}
+	}
+	cached, _ := oc.Peek(changedOrder.OrderUID)
+	assert.Equal("Kazan", cached.Delivery.City, "без repair кэш не меняется")
+
+	// Выборка ограничивает количество проверенных заказов
+	report, err = auditor.Run(Options{Sample: 2})
+	assert.NoError(err)
+	assert.Equal(5, report.Cached)
+	assert.Equal(2, report.Checked)
+
+	report, err = auditor.Run(Options{Repair: true})
+	assert.NoError(err)
+	assert.Equal(2, report.Repaired)
+	cached, _ = oc.Peek(changedOrder.OrderUID)
+	assert.Equal("Moscow", cached.Delivery.City)
+	_, exists := oc.Peek("order-4")
+	assert.False(exists)
+
+	report, err = auditor.Run(Options{})
+	assert.NoError(err)
+	assert.Equal(4, report.Checked)
+	assert.Empty(report.Divergences)
+}
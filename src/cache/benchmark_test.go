@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wild_project/src/models"
+)
+
+// baselineOrderCache копия OrderCache до шардирования: один RWMutex на весь кэш
+// и запись в лог при каждом обращении. Нужна только для сравнения в бенчмарках.
+type baselineOrderCache struct {
+	mu     sync.RWMutex
+	orders map[string]models.Order
+}
+
+func (oc *baselineOrderCache) Add(order models.Order) {
+	startTime := time.Now()
+	defer func() {
+		logger.Printf("Add выполнена за %s", time.Since(startTime))
+	}()
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	oc.orders[order.OrderUID] = order
+	logger.Println("Order added to cache:", order.OrderUID)
+}
+
+func (oc *baselineOrderCache) Get(orderUID string) (models.Order, bool) {
+	startTime := time.Now()
+	defer func() {
+		logger.Printf("Get выполнена за %s", time.Since(startTime))
+	}()
+
+	oc.mu.RLock()
+	defer oc.mu.RUnlock()
+	order, exists := oc.orders[orderUID]
+	return order, exists
+}
+
+// benchmarkCache методы кэша, которые нагружает benchmarkMixed
+type benchmarkCache interface {
+	Add(order models.Order)
+	Get(orderUID string) (models.Order, bool)
+}
+
+// benchmarkMixed нагружает кэш параллельными запросами: на каждые writeEvery-1 чтений одна запись
+func benchmarkMixed(b *testing.B, oc benchmarkCache, writeEvery int) {
+	const orders = 10000
+	uids := make([]string, orders)
+	for i := range uids {
+		uids[i] = fmt.Sprintf("order-%d", i)
+		oc.Add(testOrder(uids[i]))
+	}
+
+	var seed atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(seed.Add(7919))
+		for pb.Next() {
+			i++
+			uid := uids[i%orders]
+			if i%writeEvery == 0 {
+				oc.Add(testOrder(uid))
+			} else {
+				oc.Get(uid)
+			}
+		}
+	})
+}
+
+// newBenchmarkCache создает шардированный кэш на все заказы бенчмарка
+func newBenchmarkCache(b *testing.B, shards int) *OrderCache {
+	oc, err := NewBoundedOrderCache(Config{Policy: PolicyLRU, Shards: shards, MaxEntries: 10000})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return oc
+}
+
+// Прежний OrderCache: общий мьютекс и лог на каждый Get и Add
+func BenchmarkOrderCacheBaseline(b *testing.B) {
+	for _, writeEvery := range []int{2, 10, 100} {
+		b.Run(fmt.Sprintf("writes=1/%d", writeEvery), func(b *testing.B) {
+			benchmarkMixed(b, &baselineOrderCache{orders: make(map[string]models.Order)}, writeEvery)
+		})
+	}
+}
+
+// Новый кэш с одним шардом: общий мьютекс без логирования каждого обращения
+func BenchmarkOrderCacheSingleLock(b *testing.B) {
+	for _, writeEvery := range []int{2, 10, 100} {
+		b.Run(fmt.Sprintf("writes=1/%d", writeEvery), func(b *testing.B) {
+			benchmarkMixed(b, newBenchmarkCache(b, 1), writeEvery)
+		})
+	}
+}
+
+func BenchmarkOrderCacheSharded(b *testing.B) {
+	for _, shards := range []int{16, 64} {
+		for _, writeEvery := range []int{2, 10, 100} {
+			b.Run(fmt.Sprintf("shards=%d/writes=1/%d", shards, writeEvery), func(b *testing.B) {
+				benchmarkMixed(b, newBenchmarkCache(b, shards), writeEvery)
+			})
+		}
+	}
+}
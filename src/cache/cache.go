@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+)
+
+// Реализации кэша заказов
+const (
+	BackendMemory = "memory" // Кэш в памяти реплики, по умолчанию
+	BackendRedis  = "redis"  // Общий для реплик кэш в Redis
+)
+
+// Cache кэш заказов, от которого зависят обработчики HTTP и приема сообщений
+type Cache interface {
+	// Add добавляет или заменяет заказ и снимает отметку о его отсутствии
+	Add(order models.Order)
+	// Update заменяет заказ после его изменения, реализации с несколькими репликами сообщают о нем остальным
+	Update(order models.Order)
+	// Created сообщает о заказах, созданных в БД и уже добавленных через Add. Реализации с несколькими
+	// репликами рассылают одно событие на все заказы, чтобы остальные реплики сняли отметки полноты
+	// с их значений вторичных индексов.
+	Created(orders []models.Order)
+	// Remove удаляет заказ, например после его удаления из БД
+	Remove(orderUID string)
+	// Get возвращает заказ по OrderUID
+	Get(orderUID string) (models.Order, bool)
+	// GetEncoded возвращает заказ, уже сериализованный в JSON, для ответа без повторной сериализации
+	GetEncoded(orderUID string) (Encoded, bool)
+	// Peek возвращает заказ, не влияя на вытеснение и метрики попаданий
+	Peek(orderUID string) (models.Order, bool)
+	// Keys возвращает OrderUID всех заказов в кэше
+	Keys() []string
+	// MarkMissing отмечает на время MissingTTL, что заказа нет в БД. Если заказ уже в кэше, отметка не остается.
+	MarkMissing(orderUID string)
+	// Missing проверяет, отмечен ли заказ как отсутствующий в БД
+	Missing(orderUID string) bool
+	// Find возвращает заказы с заданным значением вторичного индекса и признак того, что в кэше есть все такие заказы
+	Find(index Index, value string) ([]models.Order, bool)
+	// ResetComplete снимает отметку о том, что в кэше есть все заказы с заданным значением вторичного индекса
+	ResetComplete(index Index, value string)
+	// AddFound добавляет все заказы с заданным значением вторичного индекса, найденные в БД
+	AddFound(index Index, value string, orders []models.Order)
+	// Count возвращает количество заказов в кэше
+	Count() int
+	// LoadFromDB загружает заказы из хранилища
+	LoadFromDB(repo repository.OrderRepository) error
+	// MarkApplied запоминает номер сообщения канала, примененного к кэшу
+	MarkApplied(sequence uint64)
+}
+
+// New создает кэш с реализацией, выбранной в cfg.Backend
+func New(cfg Config) (Cache, error) {
+	switch cfg.Backend {
+	case BackendMemory, "":
+		return NewBoundedOrderCache(cfg)
+	case BackendRedis:
+		return NewRedisCache(cfg)
+	default:
+		return nil, fmt.Errorf("неизвестная реализация кэша: %s", cfg.Backend)
+	}
+}
+
+// appliedSequence наибольший номер сообщения канала, примененного к кэшу
+type appliedSequence struct {
+	sequence uint64
+}
+
+// MarkApplied запоминает номер сообщения канала, примененного к кэшу
+func (a *appliedSequence) MarkApplied(sequence uint64) {
+	for {
+		current := atomic.LoadUint64(&a.sequence)
+		if sequence <= current || atomic.CompareAndSwapUint64(&a.sequence, current, sequence) {
+			return
+		}
+	}
+}
+
+// LastSequence возвращает наибольший номер сообщения канала, примененного к кэшу
+func (a *appliedSequence) LastSequence() uint64 {
+	return atomic.LoadUint64(&a.sequence)
+}
+
+var (
+	_ Cache = (*OrderCache)(nil)
+	_ Cache = (*RedisCache)(nil)
+)
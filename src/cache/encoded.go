@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"wild_project/src/models"
+)
+
+// Encoded заказ, заранее сериализованный для ответа HTTP
+type Encoded struct {
+	JSON []byte // JSON заказа с переводом строки в конце, как у json.Encoder
+	Gzip []byte // JSON, сжатый gzip, nil если сжатие отключено
+	ETag string // Строгий ETag по содержимому JSON, в кавычках
+}
+
+// Encode сериализует заказ и при withGzip готовит сжатый вариант
+func Encode(order models.Order, withGzip bool) (Encoded, error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return Encoded{}, err
+	}
+	return encodeJSON(append(data, '\n'), withGzip)
+}
+
+// encodeJSON вычисляет ETag и сжатый вариант для готового JSON
+func encodeJSON(data []byte, withGzip bool) (Encoded, error) {
+	sum := sha256.Sum256(data)
+	encoded := Encoded{JSON: data, ETag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+	if withGzip {
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return Encoded{}, err
+		}
+		if _, err := zw.Write(data); err != nil {
+			return Encoded{}, err
+		}
+		if err := zw.Close(); err != nil {
+			return Encoded{}, err
+		}
+		encoded.Gzip = buf.Bytes()
+	}
+	return encoded, nil
+}
+
+// size возвращает объем памяти, занятый сериализованными данными
+func (e Encoded) size() int64 {
+	return int64(len(e.JSON) + len(e.Gzip) + len(e.ETag))
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"time"
+	"wild_project/src/models"
+)
+
+// Политики вытеснения заказов из кэша
+const (
+	PolicyLRU = "lru" // Вытесняется заказ, который дольше всех не запрашивали
+	PolicyLFU = "lfu" // Вытесняется заказ с наименьшим числом обращений
+	PolicyTTL = "ttl" // Заказы хранятся TTL, при переполнении вытесняются самые старые
+)
+
+// defaultShards количество шардов кэша по умолчанию
+const defaultShards = 16
+
+// Config настройки кэша. Нулевые MaxEntries и MaxBytes снимают соответствующее ограничение.
+// Для Redis используется только TTL, память ограничивается настройкой maxmemory самого Redis.
+type Config struct {
+	Backend    string // memory или redis
+	RedisURL   string // Адрес Redis, например redis://localhost:6379/0
+	Policy     string
+	Shards     int           // Количество шардов, 0 или 1 - один общий мьютекс
+	MaxEntries int           // Максимальное количество заказов
+	MaxBytes   int64         // Примерный бюджет памяти на заказы в байтах
+	TTL        time.Duration // Время жизни заказа, обязательно для политики ttl, для остальных необязательно
+	Gzip       bool          // Хранить рядом с JSON заказа его сжатый gzip вариант
+	MissingTTL time.Duration // Сколько помнить OrderUID, которых нет в БД, 0 - не запоминать
+}
+
+// entry заказ в кэше вместе со служебными данными политики вытеснения
+type entry struct {
+	order   models.Order
+	encoded Encoded // JSON заказа для ответа без повторной сериализации
+	size    int64
+	expires time.Time // Нулевое значение - запись не устаревает
+	hits    uint64
+	seq     uint64        // Порядковый номер последнего обращения, для LFU при равном числе обращений
+	elem    *list.Element // Позиция в списке LRU и TTL
+	index   int           // Позиция в куче LFU
+}
+
+// policy порядок вытеснения записей
+type policy interface {
+	add(e *entry)
+	touch(e *entry)
+	remove(e *entry)
+	victim() *entry // Запись, которая будет вытеснена следующей, nil если кэш пуст
+}
+
+// newPolicy создает политику по имени из конфигурации
+func newPolicy(cfg Config) (policy, error) {
+	switch cfg.Policy {
+	case PolicyLRU, "":
+		return &listPolicy{order: list.New(), moveOnTouch: true}, nil
+	case PolicyTTL:
+		if cfg.TTL <= 0 {
+			return nil, fmt.Errorf("для политики %s нужно задать TTL", PolicyTTL)
+		}
+		return &listPolicy{order: list.New()}, nil
+	case PolicyLFU:
+		return &lfuPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("неизвестная политика вытеснения: %s", cfg.Policy)
+	}
+}
+
+// listPolicy вытесняет запись из конца списка. Для LRU запрошенная запись переносится в начало,
+// для TTL список остается в порядке добавления, и в конце оказываются записи, которые устареют первыми.
+type listPolicy struct {
+	order       *list.List
+	moveOnTouch bool
+}
+
+func (p *listPolicy) add(e *entry) {
+	e.elem = p.order.PushFront(e)
+}
+
+func (p *listPolicy) touch(e *entry) {
+	if p.moveOnTouch {
+		p.order.MoveToFront(e.elem)
+	}
+}
+
+func (p *listPolicy) remove(e *entry) {
+	p.order.Remove(e.elem)
+}
+
+func (p *listPolicy) victim() *entry {
+	if back := p.order.Back(); back != nil {
+		return back.Value.(*entry)
+	}
+	return nil
+}
+
+// lfuPolicy вытесняет запись с наименьшим числом обращений, из равных - давнее запрошенную
+type lfuPolicy struct {
+	entries []*entry
+}
+
+func (p *lfuPolicy) add(e *entry) {
+	heap.Push(p, e)
+}
+
+func (p *lfuPolicy) touch(e *entry) {
+	heap.Fix(p, e.index)
+}
+
+func (p *lfuPolicy) remove(e *entry) {
+	heap.Remove(p, e.index)
+}
+
+func (p *lfuPolicy) victim() *entry {
+	if len(p.entries) == 0 {
+		return nil
+	}
+	return p.entries[0]
+}
+
+// Методы heap.Interface
+
+func (p *lfuPolicy) Len() int { return len(p.entries) }
+
+func (p *lfuPolicy) Less(i, j int) bool {
+	a, b := p.entries[i], p.entries[j]
+	if a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.seq < b.seq
+}
+
+func (p *lfuPolicy) Swap(i, j int) {
+	p.entries[i], p.entries[j] = p.entries[j], p.entries[i]
+	p.entries[i].index = i
+	p.entries[j].index = j
+}
+
+func (p *lfuPolicy) Push(x any) {
+	e := x.(*entry)
+	e.index = len(p.entries)
+	p.entries = append(p.entries, e)
+}
+
+func (p *lfuPolicy) Pop() any {
+	last := len(p.entries) - 1
+	e := p.entries[last]
+	p.entries[last] = nil
+	p.entries = p.entries[:last]
+	return e
+}
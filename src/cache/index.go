@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"sync"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+)
+
+// Index вторичный индекс кэша
+type Index string
+
+// Вторичные индексы, по которым можно искать заказы. Имена совпадают с полями поиска хранилища.
+const (
+	IndexTrackNumber Index = repository.FieldTrackNumber
+	IndexCustomerID  Index = repository.FieldCustomerID
+	IndexTransaction Index = repository.FieldTransaction // Payment.Transaction
+	IndexRID         Index = repository.FieldRID         // RID позиции заказа
+)
+
+// Indexes все вторичные индексы
+var Indexes = []Index{IndexTrackNumber, IndexCustomerID, IndexTransaction, IndexRID}
+
+// indexKey значение вторичного индекса
+type indexKey struct {
+	index Index
+	value string
+}
+
+// indexKeys возвращает значения всех вторичных индексов заказа
+func indexKeys(order models.Order) []indexKey {
+	keys := []indexKey{
+		{IndexTrackNumber, order.TrackNumber},
+		{IndexCustomerID, order.CustomerID},
+		{IndexTransaction, order.Payment.Transaction},
+	}
+	for _, item := range order.Items {
+		keys = append(keys, indexKey{IndexRID, item.RID})
+	}
+	return keys
+}
+
+// IndexValue значение вторичного индекса заказа
+type IndexValue struct {
+	Index Index  `json:"Index"`
+	Value string `json:"Value"`
+}
+
+// IndexValues возвращает непустые значения всех вторичных индексов заказа без повторов
+func IndexValues(order models.Order) []IndexValue {
+	var values []IndexValue
+	seen := make(map[indexKey]bool)
+	for _, key := range indexKeys(order) {
+		if key.value == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		values = append(values, IndexValue{Index: key.index, Value: key.value})
+	}
+	return values
+}
+
+// hasIndexValue проверяет, есть ли у заказа значение вторичного индекса key
+func hasIndexValue(order models.Order, key indexKey) bool {
+	for _, k := range indexKeys(order) {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// secondaryIndex соответствие значений вторичных индексов и OrderUID заказов в кэше.
+// Обновляется шардами под их мьютексом, поэтому мьютекс индекса всегда берется после мьютекса шарда.
+type secondaryIndex struct {
+	mu       sync.RWMutex
+	uids     map[indexKey]map[string]struct{}
+	complete map[indexKey]bool // Значения, для которых в кэше есть все заказы из БД
+}
+
+func newSecondaryIndex() *secondaryIndex {
+	return &secondaryIndex{
+		uids:     make(map[indexKey]map[string]struct{}),
+		complete: make(map[indexKey]bool),
+	}
+}
+
+// add добавляет заказ во все индексы
+func (idx *secondaryIndex) add(order models.Order) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, key := range indexKeys(order) {
+		if key.value == "" {
+			continue
+		}
+		set, exists := idx.uids[key]
+		if !exists {
+			set = make(map[string]struct{})
+			idx.uids[key] = set
+		}
+		set[order.OrderUID] = struct{}{}
+	}
+}
+
+// remove удаляет заказ из всех индексов. Если заказ вытеснен, в кэше больше нет полного набора
+// заказов для его значений, и следующий поиск по ним пойдет в БД.
+func (idx *secondaryIndex) remove(order models.Order, evicted bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, key := range indexKeys(order) {
+		if evicted {
+			delete(idx.complete, key)
+		}
+		set := idx.uids[key]
+		delete(set, order.OrderUID)
+		if len(set) == 0 {
+			delete(idx.uids, key)
+		}
+	}
+}
+
+// lookup возвращает OrderUID заказов с заданным значением индекса и признак полноты набора
+func (idx *secondaryIndex) lookup(key indexKey) ([]string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	uids := make([]string, 0, len(idx.uids[key]))
+	for uid := range idx.uids[key] {
+		uids = append(uids, uid)
+	}
+	return uids, idx.complete[key]
+}
+
+// markComplete отмечает, что в кэш загружены все заказы с заданным значением индекса
+func (idx *secondaryIndex) markComplete(key indexKey) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.complete[key] = true
+}
+
+// resetComplete снимает отметку полноты набора заказов со значением индекса
+func (idx *secondaryIndex) resetComplete(key indexKey) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	delete(idx.complete, key)
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// maxMissing ограничивает количество отметок об отсутствии заказа, чтобы запросы
+// со случайными ID не занимали память без предела
+const maxMissing = 100000
+
+// negativeCache недолго помнит OrderUID, которых нет в БД, чтобы повторные запросы к ним
+// не доходили до БД. Отметка снимается, когда заказ добавляется в кэш.
+type negativeCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration // Нулевое значение отключает отметки
+	expires map[string]time.Time
+}
+
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	return &negativeCache{ttl: ttl, expires: make(map[string]time.Time)}
+}
+
+// mark отмечает, что заказа нет в БД
+func (n *negativeCache) mark(orderUID string, now time.Time) {
+	if n.ttl <= 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.expires) >= maxMissing {
+		for uid, expires := range n.expires {
+			if now.After(expires) {
+				delete(n.expires, uid)
+			}
+		}
+		if len(n.expires) >= maxMissing {
+			return
+		}
+	}
+	n.expires[orderUID] = now.Add(n.ttl)
+}
+
+// has проверяет, есть ли действующая отметка об отсутствии заказа
+func (n *negativeCache) has(orderUID string, now time.Time) bool {
+	if n.ttl <= 0 {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	expires, exists := n.expires[orderUID]
+	if exists && now.After(expires) {
+		delete(n.expires, orderUID)
+		return false
+	}
+	return exists
+}
+
+// forget снимает отметку, когда заказ появился
+func (n *negativeCache) forget(orderUID string) {
+	if n.ttl <= 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.expires, orderUID)
+}
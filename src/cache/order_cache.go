@@ -2,11 +2,12 @@ package cache
 
 import (
 	"gopkg.in/natefinch/lumberjack.v2"
-	"gorm.io/gorm"
+	"hash/fnv"
 	"log"
-	"sync"
+	"sort"
 	"time"
 	"wild_project/src/models"
+	"wild_project/src/repository"
 )
 
 const (
@@ -31,54 +32,163 @@ func createLogger(filePath string) *log.Logger {
 	}, logPrefix, logFlag)
 }
 
-// OrderCache структура для кеширования заказов
+// OrderCache структура для кеширования заказов с ограничением по количеству и объему памяти.
+// Заказы распределяются по шардам по хешу OrderUID, у каждого шарда свой мьютекс,
+// поэтому запросы к разным заказам не ждут друг друга.
 type OrderCache struct {
-	mu     sync.RWMutex
-	orders map[string]models.Order
+	appliedSequence // Последний примененный номер сообщения канала, для снимков
+	cfg             Config
+	shards          []*shard
+	index           *secondaryIndex
+	missing         *negativeCache
 }
 
-// NewOrderCache создает новый экземпляр OrderCache
+// NewOrderCache создает новый экземпляр OrderCache без ограничений
 func NewOrderCache() *OrderCache {
-	return &OrderCache{
-		orders: make(map[string]models.Order),
+	oc, _ := NewBoundedOrderCache(Config{Policy: PolicyLRU, Shards: defaultShards})
+	return oc
+}
+
+// NewBoundedOrderCache создает кэш с политикой вытеснения и ограничениями из cfg.
+// Ограничения делятся между шардами поровну.
+func NewBoundedOrderCache(cfg Config) (*OrderCache, error) {
+	if cfg.Shards < 1 {
+		cfg.Shards = 1
+	}
+	oc := &OrderCache{
+		cfg:     cfg,
+		shards:  make([]*shard, cfg.Shards),
+		index:   newSecondaryIndex(),
+		missing: newNegativeCache(cfg.MissingTTL),
+	}
+	for i := range oc.shards {
+		s, err := newShard(cfg, oc.index)
+		if err != nil {
+			return nil, err
+		}
+		oc.shards[i] = s
+	}
+	return oc, nil
+}
+
+// shardFor выбирает шард по хешу OrderUID. Shardkey заказа для этого не подходит:
+// при запросе по OrderUID он еще неизвестен.
+func (oc *OrderCache) shardFor(orderUID string) *shard {
+	if len(oc.shards) == 1 {
+		return oc.shards[0]
 	}
+	h := fnv.New32a()
+	h.Write([]byte(orderUID))
+	return oc.shards[h.Sum32()%uint32(len(oc.shards))]
 }
 
-// Add добавляет заказ в кеш
+// Add добавляет заказ в кеш и вытесняет лишние заказы, если превышены ограничения.
+// Отметка об отсутствии снимается после добавления, см. MarkMissing.
 func (oc *OrderCache) Add(order models.Order) {
-	startTime := time.Now()
-	defer func() {
-		logger.Printf("Add выполнена за %s", time.Since(startTime))
-	}()
+	oc.shardFor(order.OrderUID).add(order, time.Now())
+	oc.missing.forget(order.OrderUID)
+}
 
-	oc.mu.Lock()
-	defer oc.mu.Unlock()
-	oc.orders[order.OrderUID] = order
-	logger.Println("Order added to cache:", order.OrderUID)
+// Update заменяет измененный заказ, для кэша одной реплики это то же, что Add
+func (oc *OrderCache) Update(order models.Order) {
+	oc.Add(order)
+}
+
+// Created ничего не делает: заказы уже добавлены, других реплик у кэша нет
+func (oc *OrderCache) Created(orders []models.Order) {}
+
+// Remove удаляет заказ из кэша
+func (oc *OrderCache) Remove(orderUID string) {
+	oc.shardFor(orderUID).delete(orderUID)
 }
 
 // Get извлекает заказ из кеша по его уникальному идентификатору
 func (oc *OrderCache) Get(orderUID string) (models.Order, bool) {
-	startTime := time.Now()
-	defer func() {
-		logger.Printf("Get выполнена за %s", time.Since(startTime))
-	}()
+	return oc.shardFor(orderUID).get(orderUID, time.Now())
+}
+
+// GetEncoded возвращает заказ, уже сериализованный в JSON
+func (oc *OrderCache) GetEncoded(orderUID string) (Encoded, bool) {
+	return oc.shardFor(orderUID).getEncoded(orderUID, time.Now())
+}
 
-	oc.mu.RLock()
-	defer oc.mu.RUnlock()
-	order, exists := oc.orders[orderUID]
-	return order, exists
+// Peek возвращает заказ, не влияя на вытеснение и метрики попаданий, для служебных проверок
+func (oc *OrderCache) Peek(orderUID string) (models.Order, bool) {
+	return oc.shardFor(orderUID).peek(orderUID, time.Now())
+}
+
+// Keys возвращает OrderUID всех заказов в кэше
+func (oc *OrderCache) Keys() []string {
+	var uids []string
+	for _, s := range oc.shards {
+		uids = append(uids, s.keys()...)
+	}
+	return uids
+}
+
+// MarkMissing отмечает, что заказа нет в БД. Отметки других реплик не снимаются:
+// заказ, принятый другой репликой, станет виден здесь не позже чем через MissingTTL.
+//
+// Заказ мог быть добавлен, пока шел запрос к БД. Если Add снял отметку раньше, чем она поставлена,
+// заказ уже лежит в шарде, поэтому после отметки он проверяется еще раз.
+func (oc *OrderCache) MarkMissing(orderUID string) {
+	now := time.Now()
+	oc.missing.mark(orderUID, now)
+	if _, exists := oc.shardFor(orderUID).peek(orderUID, now); exists {
+		oc.missing.forget(orderUID)
+	}
+}
+
+// Missing проверяет, отмечен ли заказ как отсутствующий в БД
+func (oc *OrderCache) Missing(orderUID string) bool {
+	return oc.missing.has(orderUID, time.Now())
+}
+
+// Find возвращает заказы из кэша с заданным значением вторичного индекса.
+// complete равен true, если в кэше есть все такие заказы и обращаться к БД не нужно.
+func (oc *OrderCache) Find(index Index, value string) (orders []models.Order, complete bool) {
+	uids, complete := oc.index.lookup(indexKey{index, value})
+	for _, uid := range uids {
+		order, exists := oc.Get(uid)
+		if !exists {
+			// Заказ вытеснили между поиском в индексе и чтением
+			complete = false
+			continue
+		}
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders, complete && len(orders) > 0
+}
+
+// ResetComplete снимает отметку полноты набора заказов со значением вторичного индекса,
+// следующий поиск по нему пойдет в БД
+func (oc *OrderCache) ResetComplete(index Index, value string) {
+	oc.index.resetComplete(indexKey{index, value})
+}
+
+// AddFound добавляет в кэш все заказы с заданным значением вторичного индекса, найденные в БД,
+// чтобы следующие поиски по этому значению обходились без БД
+func (oc *OrderCache) AddFound(index Index, value string, orders []models.Order) {
+	if len(orders) == 0 {
+		return
+	}
+	// Отметка ставится до добавления: если добавление вытеснит часть этих заказов, она будет снята
+	oc.index.markComplete(indexKey{index, value})
+	for _, order := range orders {
+		oc.Add(order)
+	}
 }
 
 // SaveToDB сохраняет заказ в базу данных и добавляет его в кеш
-func (oc *OrderCache) SaveToDB(db *gorm.DB, order models.Order) error {
+func (oc *OrderCache) SaveToDB(repo repository.OrderRepository, order models.Order) error {
 	startTime := time.Now()
 	defer func() {
 		logger.Printf("SaveToDB выполнена за %s", time.Since(startTime))
 	}()
 
 	if _, exists := oc.Get(order.OrderUID); !exists {
-		if err := db.Create(&order).Error; err != nil {
+		if err := repo.Create(&order); err != nil {
 			logger.Printf("Ошибка при сохранении заказа в БД: %v", err)
 			return err
 		}
@@ -88,32 +198,29 @@ func (oc *OrderCache) SaveToDB(db *gorm.DB, order models.Order) error {
 	return nil
 }
 
-// LoadFromDB принимает объект базы данных *gorm.DB в качестве параметра и выполняет запрос на получение всех заказов.
-func (oc *OrderCache) LoadFromDB(db *gorm.DB) error {
+// LoadFromDB загружает в кэш заказы со всеми связанными записями, читая таблицу пачками
+func (oc *OrderCache) LoadFromDB(repo repository.OrderRepository) error {
 	startTime := time.Now()
 	defer func() {
 		logger.Printf("LoadFromDB выполнена за %s", time.Since(startTime))
 	}()
 
-	var orders []models.Order
-	if err := db.Find(&orders).Error; err != nil {
-		return err
-	}
-
-	for _, order := range orders {
-		oc.Add(order)
-	}
-	return nil
+	// При ограниченном размере загружаются только самые новые заказы,
+	// остальные попадут в кэш при первом запросе через БД.
+	// Заказы читаются от старых к новым, чтобы новые вытеснялись последними.
+	return repo.StreamAll(repository.StreamOptions{Newest: oc.cfg.MaxEntries}, func(orders []models.Order) error {
+		for _, order := range orders {
+			oc.Add(order)
+		}
+		return nil
+	})
 }
 
 // Count возвращает количество заказов в кэше
 func (oc *OrderCache) Count() int {
-	startTime := time.Now()
-	defer func() {
-		logger.Printf("Count выполнена за %s", time.Since(startTime))
-	}()
-
-	oc.mu.RLock()
-	defer oc.mu.RUnlock()
-	return len(oc.orders)
+	count := 0
+	for _, s := range oc.shards {
+		count += s.count()
+	}
+	return count
 }
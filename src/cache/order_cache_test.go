@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+// testOrder создает заказ с заданным OrderUID
+func testOrder(uid string) models.Order {
+	return models.Order{OrderUID: uid, TrackNumber: "WBILMTESTTRACK", Items: []models.Items{{ChrtID: 1}}}
+}
+
+func TestOrderCacheLRU(t *testing.T) {
+	assert := assert.New(t)
+	oc, err := NewBoundedOrderCache(Config{Policy: PolicyLRU, MaxEntries: 2})
+	assert.NoError(err)
+
+	oc.Add(testOrder("a"))
+	oc.Add(testOrder("b"))
+	_, exists := oc.Get("a")
+	assert.True(exists)
+	oc.Add(testOrder("c"))
+
+	_, exists = oc.Get("b")
+	assert.False(exists, "давнее всех запрошенный заказ вытесняется")
+	_, exists = oc.Get("a")
+	assert.True(exists)
+	assert.Equal(2, oc.Count())
+}
+
+func TestOrderCacheLFU(t *testing.T) {
+	assert := assert.New(t)
+	oc, err := NewBoundedOrderCache(Config{Policy: PolicyLFU, MaxEntries: 2})
+	assert.NoError(err)
+
+	oc.Add(testOrder("a"))
+	oc.Add(testOrder("b"))
+	oc.Get("a")
+	oc.Get("a")
+	oc.Get("b")
+	oc.Add(testOrder("c"))
+
+	_, exists := oc.Get("b")
+	assert.False(exists, "заказ с наименьшим числом обращений вытесняется")
+	_, exists = oc.Get("a")
+	assert.True(exists)
+	_, exists = oc.Get("c")
+	assert.True(exists)
+}
+
+func TestOrderCacheTTL(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewBoundedOrderCache(Config{Policy: PolicyTTL})
+	assert.Error(err, "для политики ttl нужен TTL")
+	_, err = NewBoundedOrderCache(Config{Policy: "random"})
+	assert.Error(err)
+
+	oc, err := NewBoundedOrderCache(Config{Policy: PolicyTTL, TTL: 20 * time.Millisecond})
+	assert.NoError(err)
+	oc.Add(testOrder("a"))
+	_, exists := oc.Get("a")
+	assert.True(exists)
+
+	time.Sleep(30 * time.Millisecond)
+	_, exists = oc.Get("a")
+	assert.False(exists)
+	assert.Equal(0, oc.Count())
+}
+
+func TestOrderCacheMemoryBudget(t *testing.T) {
+	assert := assert.New(t)
+	size := newEntry(testOrder("order-0"), false).size
+	oc, err := NewBoundedOrderCache(Config{Policy: PolicyLRU, MaxBytes: 3 * size})
+	assert.NoError(err)
+
+	for i := 0; i < 10; i++ {
+		oc.Add(testOrder(fmt.Sprintf("order-%d", i)))
+	}
+	assert.Equal(3, oc.Count())
+	_, exists := oc.Get("order-9")
+	assert.True(exists)
+
+	// Повторное добавление заменяет заказ, а не занимает память дважды
+	oc.Add(testOrder("order-9"))
+	assert.Equal(3, oc.Count())
+
+	big := testOrder("big")
+	big.InternalSignature = strings.Repeat("x", int(4*size))
+	assert.Greater(newEntry(big, false).size, 4*size)
+	oc.Add(big)
+	assert.Equal(1, oc.Count(), "заказ больше бюджета вытесняет все остальные")
+}
+
+func TestLoadFromDBKeepsNewest(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	for i := 0; i < 5; i++ {
+		order := testOrder(fmt.Sprintf("order-%d", i))
+		assert.NoError(db.Create(&order).Error)
+	}
+
+	oc, err := NewBoundedOrderCache(Config{Policy: PolicyLRU, MaxEntries: 2})
+	assert.NoError(err)
+	assert.NoError(oc.LoadFromDB(repository.NewGormRepository(db)))
+	assert.Equal(2, oc.Count())
+	_, exists := oc.Get("order-4")
+	assert.True(exists)
+	_, exists = oc.Get("order-3")
+	assert.True(exists)
+}
+
+func TestShardedOrderCache(t *testing.T) {
+	assert := assert.New(t)
+	oc, err := NewBoundedOrderCache(Config{Policy: PolicyLRU, Shards: 8, MaxEntries: 80})
+	assert.NoError(err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				uid := fmt.Sprintf("order-%d-%d", w, i)
+				oc.Add(testOrder(uid))
+				oc.Get(uid)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Ограничение делится между шардами, общее количество не превышает MaxEntries
+	assert.LessOrEqual(oc.Count(), 80)
+	assert.Greater(oc.Count(), 40)
+	oc.Add(testOrder("last"))
+	order, exists := oc.Get("last")
+	assert.True(exists, "последний добавленный заказ шарда не вытесняется")
+	assert.Equal("last", order.OrderUID)
+}
+
+func TestOrderCacheSecondaryIndexes(t *testing.T) {
+	assert := assert.New(t)
+	oc, err := NewBoundedOrderCache(Config{Policy: PolicyLRU, MaxEntries: 4})
+	assert.NoError(err)
+
+	var orders []models.Order
+	for i := 0; i < 3; i++ {
+		order := testOrder(fmt.Sprintf("order-%d", i))
+		order.ID = uint(i + 1)
+		order.CustomerID = "customer"
+		order.Payment.Transaction = fmt.Sprintf("tx-%d", i)
+		order.Items[0].RID = fmt.Sprintf("rid-%d", i)
+		orders = append(orders, order)
+	}
+	oc.Add(orders[0])
+
+	// Заказ добавлен при приеме сообщения, но остальные заказы покупателя могут быть только в БД
+	found, complete := oc.Find(IndexCustomerID, "customer")
+	assert.Len(found, 1)
+	assert.False(complete)
+
+	oc.AddFound(IndexCustomerID, "customer", orders)
+	found, complete = oc.Find(IndexCustomerID, "customer")
+	assert.True(complete)
+	if assert.Len(found, 3) {
+		assert.Equal("order-0", found[0].OrderUID)
+	}
+	found, _ = oc.Find(IndexRID, "rid-2")
+	if assert.Len(found, 1) {
+		assert.Equal("order-2", found[0].OrderUID)
+	}
+
+	// Замена заказа новой версией переносит его между значениями индекса
+	moved := orders[1]
+	moved.CustomerID = "other"
+	oc.Add(moved)
+	found, complete = oc.Find(IndexCustomerID, "customer")
+	assert.Len(found, 2)
+	assert.True(complete)
+	found, _ = oc.Find(IndexCustomerID, "other")
+	assert.Len(found, 1)
+
+	// Вытеснение удаляет заказ из индексов и снимает отметку полноты
+	for i := 0; i < 4; i++ {
+		oc.Add(testOrder(fmt.Sprintf("filler-%d", i)))
+	}
+	found, complete = oc.Find(IndexCustomerID, "customer")
+	assert.Empty(found)
+	assert.False(complete)
+	found, _ = oc.Find(IndexTransaction, "tx-0")
+	assert.Empty(found)
+}
@@ -0,0 +1,386 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strings"
+	"time"
+	"wild_project/src/models"
+	"wild_project/src/my_prometheus"
+	"wild_project/src/repository"
+)
+
+// Ключи Redis
+const (
+	redisOrderPrefix    = "order:"          // order:<OrderUID> - заказ в JSON
+	redisIndexPrefix    = "order-index:"    // order-index:<индекс>:<значение> - множество OrderUID
+	redisCompletePrefix = "order-complete:" // order-complete:<индекс>:<значение> - в кэше есть все такие заказы
+	redisMissingPrefix  = "order-missing:"  // order-missing:<OrderUID> - заказа нет в БД
+	redisTimeout        = time.Second
+	redisWatchRetries   = 10 // Попыток изменить заказ, который параллельно меняют другие реплики
+)
+
+// RedisCache кэш заказов в Redis, общий для всех реплик сервиса.
+// Ошибки Redis логируются, а запрос считается промахом, чтобы обработчики шли в БД.
+type RedisCache struct {
+	appliedSequence
+	client     *redis.Client
+	ttl        time.Duration
+	missingTTL time.Duration
+}
+
+// NewRedisCache подключается к Redis по адресу cfg.RedisURL
+func NewRedisCache(cfg Config) (*RedisCache, error) {
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &RedisCache{client: client, ttl: cfg.TTL, missingTTL: cfg.MissingTTL}, nil
+}
+
+// Close закрывает соединение с Redis
+func (rc *RedisCache) Close() error {
+	return rc.client.Close()
+}
+
+func orderKey(orderUID string) string {
+	return redisOrderPrefix + orderUID
+}
+
+func missingKey(orderUID string) string {
+	return redisMissingPrefix + orderUID
+}
+
+func (k indexKey) redisKey() string {
+	return redisIndexPrefix + string(k.index) + ":" + k.value
+}
+
+func (k indexKey) redisCompleteKey() string {
+	return redisCompletePrefix + string(k.index) + ":" + k.value
+}
+
+// Add записывает заказ и переносит его между значениями вторичных индексов, если они изменились
+func (rc *RedisCache) Add(order models.Order) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := rc.add(ctx, order); err != nil {
+		logger.Printf("Ошибка записи заказа %s в Redis: %v", order.OrderUID, err)
+	}
+}
+
+func (rc *RedisCache) add(ctx context.Context, order models.Order) error {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	// Прежняя версия читается под WATCH: если другая реплика успеет заменить заказ,
+	// транзакция не выполнится и повторится уже с ее версией заказа
+	return rc.watch(ctx, order.OrderUID, func(tx *redis.Tx) error {
+		previous, exists, err := rc.getFrom(ctx, tx, order.OrderUID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if exists {
+				for _, key := range indexKeys(previous) {
+					pipe.SRem(ctx, key.redisKey(), order.OrderUID)
+				}
+			}
+			pipe.Set(ctx, orderKey(order.OrderUID), data, rc.ttl)
+			pipe.Del(ctx, missingKey(order.OrderUID))
+			for _, key := range indexKeys(order) {
+				if key.value == "" {
+					continue
+				}
+				pipe.SAdd(ctx, key.redisKey(), order.OrderUID)
+				if rc.ttl > 0 {
+					pipe.Expire(ctx, key.redisKey(), rc.ttl)
+				}
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+// watch выполняет fn под WATCH ключа заказа и повторяет ее, если заказ изменили параллельно
+func (rc *RedisCache) watch(ctx context.Context, orderUID string, fn func(tx *redis.Tx) error) error {
+	var err error
+	for i := 0; i < redisWatchRetries; i++ {
+		err = rc.client.Watch(ctx, fn, orderKey(orderUID))
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return err
+}
+
+// Update заменяет измененный заказ. Redis общий для всех реплик, сообщать им не нужно.
+func (rc *RedisCache) Update(order models.Order) {
+	rc.Add(order)
+}
+
+// Created ничего не делает: Redis общий для всех реплик, заказы в нем уже есть
+func (rc *RedisCache) Created(orders []models.Order) {}
+
+// Remove удаляет заказ и его значения вторичных индексов
+func (rc *RedisCache) Remove(orderUID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	err := rc.watch(ctx, orderUID, func(tx *redis.Tx) error {
+		previous, exists, err := rc.getFrom(ctx, tx, orderUID)
+		if err != nil || !exists {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range indexKeys(previous) {
+				pipe.SRem(ctx, key.redisKey(), orderUID)
+				pipe.Del(ctx, key.redisCompleteKey())
+			}
+			pipe.Del(ctx, orderKey(orderUID))
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		logger.Printf("Ошибка удаления заказа %s из Redis: %v", orderUID, err)
+	}
+}
+
+// Get извлекает заказ по OrderUID
+func (rc *RedisCache) Get(orderUID string) (models.Order, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	order, exists, err := rc.get(ctx, orderUID)
+	if err != nil {
+		logger.Printf("Ошибка чтения заказа %s из Redis: %v", orderUID, err)
+	}
+	if !exists {
+		my_prometheus.CacheMisses.Inc()
+		return models.Order{}, false
+	}
+	my_prometheus.CacheHits.Inc()
+	return order, true
+}
+
+// MarkMissing отмечает, что заказа нет в БД, если его нет и в Redis.
+// Отметка общая для всех реплик и снимается при добавлении заказа.
+func (rc *RedisCache) MarkMissing(orderUID string) {
+	if rc.missingTTL <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	// Под WATCH ключа заказа: если заказ записан, пока шел запрос к БД, отметка не ставится
+	err := rc.watch(ctx, orderUID, func(tx *redis.Tx) error {
+		n, err := tx.Exists(ctx, orderKey(orderUID)).Result()
+		if err != nil || n > 0 {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, missingKey(orderUID), 1, rc.missingTTL)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		logger.Printf("Ошибка записи отметки об отсутствии заказа %s в Redis: %v", orderUID, err)
+	}
+}
+
+// Missing проверяет, отмечен ли заказ как отсутствующий в БД. При ошибке Redis считается,
+// что отметки нет, и обработчик идет в БД.
+func (rc *RedisCache) Missing(orderUID string) bool {
+	if rc.missingTTL <= 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := rc.client.Exists(ctx, missingKey(orderUID)).Result()
+	if err != nil {
+		logger.Printf("Ошибка чтения отметки об отсутствии заказа %s из Redis: %v", orderUID, err)
+		return false
+	}
+	return n > 0
+}
+
+// GetEncoded возвращает заказ в том JSON, в котором он хранится в Redis, без десериализации.
+// Сжатый вариант не хранится: его пришлось бы вычислять при каждом чтении.
+func (rc *RedisCache) GetEncoded(orderUID string) (Encoded, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := rc.client.Get(ctx, orderKey(orderUID)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logger.Printf("Ошибка чтения заказа %s из Redis: %v", orderUID, err)
+		}
+		my_prometheus.CacheMisses.Inc()
+		return Encoded{}, false
+	}
+	my_prometheus.CacheHits.Inc()
+	encoded, _ := encodeJSON(append(data, '\n'), false)
+	return encoded, true
+}
+
+func (rc *RedisCache) get(ctx context.Context, orderUID string) (models.Order, bool, error) {
+	return rc.getFrom(ctx, rc.client, orderUID)
+}
+
+// getFrom читает заказ через c, например внутри WATCH
+func (rc *RedisCache) getFrom(ctx context.Context, c redis.Cmdable, orderUID string) (models.Order, bool, error) {
+	data, err := c.Get(ctx, orderKey(orderUID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return models.Order{}, false, nil
+	}
+	if err != nil {
+		return models.Order{}, false, err
+	}
+	var order models.Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		return models.Order{}, false, err
+	}
+	return order, true, nil
+}
+
+// Find возвращает заказы с заданным значением вторичного индекса.
+// Если часть заказов Redis уже вытеснил или удалил по TTL, набор считается неполным.
+// Заказы, у которых значение поля уже другое, пропускаются: в индексе мог остаться
+// их OrderUID, например после сбоя между репликами, и такой набор тоже считается неполным.
+func (rc *RedisCache) Find(index Index, value string) ([]models.Order, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	key := indexKey{index, value}
+
+	uids, err := rc.client.SMembers(ctx, key.redisKey()).Result()
+	if err != nil {
+		logger.Printf("Ошибка чтения индекса %s из Redis: %v", key.redisKey(), err)
+		return nil, false
+	}
+	complete, err := rc.client.Exists(ctx, key.redisCompleteKey()).Result()
+	if err != nil {
+		logger.Printf("Ошибка чтения индекса %s из Redis: %v", key.redisKey(), err)
+		return nil, false
+	}
+	if len(uids) == 0 {
+		return nil, false
+	}
+
+	keys := make([]string, len(uids))
+	for i, uid := range uids {
+		keys[i] = orderKey(uid)
+	}
+	values, err := rc.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		logger.Printf("Ошибка чтения заказов из Redis: %v", err)
+		return nil, false
+	}
+
+	var orders []models.Order
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			complete = 0
+			continue
+		}
+		var order models.Order
+		if err := json.Unmarshal([]byte(data), &order); err != nil {
+			complete = 0
+			continue
+		}
+		if !hasIndexValue(order, key) {
+			complete = 0
+			continue
+		}
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders, complete > 0 && len(orders) > 0
+}
+
+// ResetComplete снимает отметку полноты набора заказов со значением вторичного индекса
+func (rc *RedisCache) ResetComplete(index Index, value string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := rc.client.Del(ctx, indexKey{index, value}.redisCompleteKey()).Err(); err != nil {
+		logger.Printf("Ошибка записи индекса в Redis: %v", err)
+	}
+}
+
+// AddFound добавляет заказы, найденные в БД, и отмечает набор как полный
+func (rc *RedisCache) AddFound(index Index, value string, orders []models.Order) {
+	if len(orders) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	for _, order := range orders {
+		if err := rc.add(ctx, order); err != nil {
+			logger.Printf("Ошибка записи заказа %s в Redis: %v", order.OrderUID, err)
+			return
+		}
+	}
+	// Отметка живет не дольше заказов, после удаления по TTL поиск снова пойдет в БД
+	if err := rc.client.Set(ctx, indexKey{index, value}.redisCompleteKey(), 1, rc.ttl).Err(); err != nil {
+		logger.Printf("Ошибка записи индекса в Redis: %v", err)
+	}
+}
+
+// Count возвращает количество заказов в Redis
+func (rc *RedisCache) Count() int {
+	return len(rc.Keys())
+}
+
+// Keys возвращает OrderUID всех заказов в Redis
+func (rc *RedisCache) Keys() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*redisTimeout)
+	defer cancel()
+	var uids []string
+	iter := rc.client.Scan(ctx, 0, redisOrderPrefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		uids = append(uids, strings.TrimPrefix(iter.Val(), redisOrderPrefix))
+	}
+	if err := iter.Err(); err != nil {
+		logger.Printf("Ошибка чтения списка заказов из Redis: %v", err)
+	}
+	return uids
+}
+
+// Peek возвращает заказ, не влияя на метрики попаданий
+func (rc *RedisCache) Peek(orderUID string) (models.Order, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	order, exists, err := rc.get(ctx, orderUID)
+	if err != nil {
+		logger.Printf("Ошибка чтения заказа %s из Redis: %v", orderUID, err)
+	}
+	return order, exists
+}
+
+// LoadFromDB загружает в Redis все заказы из БД пачками
+func (rc *RedisCache) LoadFromDB(repo repository.OrderRepository) error {
+	startTime := time.Now()
+	defer func() {
+		logger.Printf("LoadFromDB выполнена за %s", time.Since(startTime))
+	}()
+
+	return repo.StreamAll(repository.StreamOptions{}, func(orders []models.Order) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*redisTimeout)
+		defer cancel()
+		for _, order := range orders {
+			if err := rc.add(ctx, order); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
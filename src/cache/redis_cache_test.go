@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+// newTestRedisCache запускает Redis в процессе теста и подключает к нему кэш
+func newTestRedisCache(t *testing.T, ttl time.Duration) (*RedisCache, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	c, err := New(Config{Backend: BackendRedis, RedisURL: "redis://" + server.Addr(), TTL: ttl})
+	if err != nil {
+		t.Fatalf("Failed to connect to miniredis: %v", err)
+	}
+	rc := c.(*RedisCache)
+	t.Cleanup(func() { rc.Close() })
+	return rc, server
+}
+
+func TestRedisCacheAddGet(t *testing.T) {
+	assert := assert.New(t)
+	rc, _ := newTestRedisCache(t, 0)
+
+	order := testOrder("a")
+	order.Delivery.City = "Moscow"
+	order.Payment.Transaction = "tx-a"
+	rc.Add(order)
+
+	cached, exists := rc.Get("a")
+	assert.True(exists)
+	assert.Equal("Moscow", cached.Delivery.City)
+	assert.Equal(order.Items, cached.Items)
+	_, exists = rc.Get("missing")
+	assert.False(exists)
+	assert.Equal(1, rc.Count())
+
+	// Сериализованный заказ совпадает с тем, что отдает кэш в памяти
+	encoded, exists := rc.GetEncoded("a")
+	assert.True(exists)
+	expected, err := Encode(order, false)
+	assert.NoError(err)
+	assert.Equal(expected, encoded)
+
+	// Второй экземпляр видит тот же заказ, как другая реплика
+	other, err := NewRedisCache(Config{RedisURL: "redis://" + rc.client.Options().Addr})
+	assert.NoError(err)
+	defer other.Close()
+	_, exists = other.Get("a")
+	assert.True(exists)
+}
+
+func TestRedisCacheSecondaryIndexes(t *testing.T) {
+	assert := assert.New(t)
+	rc, server := newTestRedisCache(t, 0)
+
+	var orders []models.Order
+	for i := 0; i < 3; i++ {
+		order := testOrder(fmt.Sprintf("order-%d", i))
+		order.ID = uint(i + 1)
+		order.CustomerID = "customer"
+		orders = append(orders, order)
+	}
+	rc.Add(orders[0])
+	found, complete := rc.Find(IndexCustomerID, "customer")
+	assert.Len(found, 1)
+	assert.False(complete)
+
+	rc.AddFound(IndexCustomerID, "customer", orders)
+	found, complete = rc.Find(IndexCustomerID, "customer")
+	assert.True(complete)
+	if assert.Len(found, 3) {
+		assert.Equal("order-0", found[0].OrderUID)
+	}
+
+	// Новая версия заказа переносится в другое значение индекса
+	moved := orders[2]
+	moved.CustomerID = "other"
+	rc.Add(moved)
+	found, _ = rc.Find(IndexCustomerID, "customer")
+	assert.Len(found, 2)
+	found, _ = rc.Find(IndexCustomerID, "other")
+	assert.Len(found, 1)
+
+	// Если Redis вытеснил заказ, набор перестает быть полным
+	server.Del(orderKey("order-0"))
+	found, complete = rc.Find(IndexCustomerID, "customer")
+	assert.Len(found, 1)
+	assert.False(complete)
+}
+
+func TestRedisCacheChangedTrackNumber(t *testing.T) {
+	assert := assert.New(t)
+	rc, server := newTestRedisCache(t, 0)
+
+	order := testOrder("a")
+	order.TrackNumber = "OLD"
+	rc.AddFound(IndexTrackNumber, "OLD", []models.Order{order})
+	order.TrackNumber = "NEW"
+	rc.Add(order)
+
+	found, complete := rc.Find(IndexTrackNumber, "OLD")
+	assert.Empty(found)
+	assert.False(complete)
+	found, _ = rc.Find(IndexTrackNumber, "NEW")
+	assert.Len(found, 1)
+
+	// OrderUID, оставшийся в старом значении индекса, не выдает заказ с другим трек-номером
+	other := testOrder("b")
+	other.TrackNumber = "OLD"
+	rc.AddFound(IndexTrackNumber, "OLD", []models.Order{other})
+	_, err := server.SAdd(indexKey{IndexTrackNumber, "OLD"}.redisKey(), "a")
+	assert.NoError(err)
+	found, complete = rc.Find(IndexTrackNumber, "OLD")
+	if assert.Len(found, 1) {
+		assert.Equal("b", found[0].OrderUID)
+	}
+	assert.False(complete)
+}
+
+func TestRedisCacheConcurrentUpdates(t *testing.T) {
+	assert := assert.New(t)
+	rc, _ := newTestRedisCache(t, 0)
+	other, err := NewRedisCache(Config{RedisURL: "redis://" + rc.client.Options().Addr})
+	assert.NoError(err)
+	defer other.Close()
+
+	// Две реплики параллельно меняют трек-номер одного заказа
+	var wg sync.WaitGroup
+	for r, replica := range []*RedisCache{rc, other} {
+		wg.Add(1)
+		go func(r int, replica *RedisCache) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				order := testOrder("a")
+				order.TrackNumber = fmt.Sprintf("TRACK-%d-%d", r, i)
+				replica.Add(order)
+			}
+		}(r, replica)
+	}
+	wg.Wait()
+
+	// OrderUID остается только в значении индекса последней версии заказа
+	order, exists := rc.Get("a")
+	assert.True(exists)
+	keys, err := rc.client.Keys(context.Background(), redisIndexPrefix+string(IndexTrackNumber)+":*").Result()
+	assert.NoError(err)
+	assert.Equal([]string{indexKey{IndexTrackNumber, order.TrackNumber}.redisKey()}, keys)
+}
+
+func TestRedisCacheTTL(t *testing.T) {
+	assert := assert.New(t)
+	rc, server := newTestRedisCache(t, time.Minute)
+
+	rc.Add(testOrder("a"))
+	_, exists := rc.Get("a")
+	assert.True(exists)
+
+	server.FastForward(2 * time.Minute)
+	_, exists = rc.Get("a")
+	assert.False(exists)
+}
+
+func TestRedisCacheMissing(t *testing.T) {
+	assert := assert.New(t)
+	rc, _ := newTestRedisCache(t, 0)
+	rc.missingTTL = time.Minute
+
+	rc.MarkMissing("a")
+	assert.True(rc.Missing("a"))
+	rc.Add(testOrder("a"))
+	assert.False(rc.Missing("a"))
+
+	// Заказ уже записан, например параллельным приемом во время запроса к БД
+	rc.MarkMissing("a")
+	assert.False(rc.Missing("a"))
+}
+
+func TestRedisCacheLoadFromDB(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	for i := 0; i < 5; i++ {
+		order := testOrder(fmt.Sprintf("order-%d", i))
+		order.Delivery.City = "Moscow"
+		assert.NoError(db.Create(&order).Error)
+	}
+
+	rc, _ := newTestRedisCache(t, 0)
+	assert.NoError(rc.LoadFromDB(repository.NewGormRepository(db)))
+	assert.Equal(5, rc.Count())
+	order, exists := rc.Get("order-3")
+	assert.True(exists)
+	assert.Equal("Moscow", order.Delivery.City)
+}
+
+func TestUnknownBackend(t *testing.T) {
+	_, err := New(Config{Backend: "memcached"})
+	assert.Error(t, err)
+}
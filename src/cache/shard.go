@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"sync"
+	"time"
+	"wild_project/src/models"
+	"wild_project/src/my_prometheus"
+)
+
+// shard часть кэша со своим мьютексом, политикой вытеснения и долей ограничений
+type shard struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	gzip       bool // Хранить сжатый вариант JSON заказа
+	orders     map[string]*entry
+	index      *secondaryIndex // Общий для всех шардов вторичный индекс
+	policy     policy
+	bytes      int64
+	counter    uint64 // Счетчик обращений для упорядочивания записей LFU
+}
+
+// newShard создает шард с долей ограничений cfg, округленной вверх
+func newShard(cfg Config, index *secondaryIndex) (*shard, error) {
+	p, err := newPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	n := cfg.Shards
+	return &shard{
+		maxEntries: (cfg.MaxEntries + n - 1) / n,
+		maxBytes:   (cfg.MaxBytes + int64(n) - 1) / int64(n),
+		ttl:        cfg.TTL,
+		gzip:       cfg.Gzip,
+		orders:     make(map[string]*entry),
+		index:      index,
+		policy:     p,
+	}, nil
+}
+
+// newEntry создает запись с заказом и его JSON. Сериализация выполняется до захвата мьютекса шарда,
+// а размер записи учитывает и заказ, и его JSON.
+func newEntry(order models.Order, withGzip bool) *entry {
+	e := &entry{order: order}
+	encoded, err := Encode(order, withGzip)
+	if err != nil {
+		logger.Printf("Ошибка сериализации заказа %s: %v", order.OrderUID, err)
+	} else {
+		e.encoded = encoded
+	}
+	e.size = orderSize(order) + e.encoded.size()
+	return e
+}
+
+// add добавляет заказ и вытесняет лишние заказы, если превышены ограничения шарда
+func (s *shard) add(order models.Order, now time.Time) {
+	e := newEntry(order, s.gzip)
+	if s.ttl > 0 {
+		e.expires = now.Add(s.ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, exists := s.orders[order.OrderUID]; exists {
+		s.remove(old, false)
+	}
+	s.counter++
+	e.seq = s.counter
+	// Место освобождается до вставки, иначе в LFU новый заказ без обращений сразу оказался бы вытеснен
+	s.evict(now, e.size)
+	s.orders[order.OrderUID] = e
+	s.bytes += e.size
+	s.policy.add(e)
+	s.index.add(order)
+	my_prometheus.CacheEntries.Inc()
+	my_prometheus.CacheBytes.Add(float64(e.size))
+}
+
+// get возвращает заказ и отмечает обращение к нему для политики вытеснения
+func (s *shard) get(orderUID string, now time.Time) (models.Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.lookup(orderUID, now); e != nil {
+		return e.order, true
+	}
+	return models.Order{}, false
+}
+
+// getEncoded возвращает сериализованный заказ и отмечает обращение к нему для политики вытеснения
+func (s *shard) getEncoded(orderUID string, now time.Time) (Encoded, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.lookup(orderUID, now); e != nil && e.encoded.JSON != nil {
+		return e.encoded, true
+	}
+	return Encoded{}, false
+}
+
+// peek возвращает заказ, не учитывая обращение в политике вытеснения и метриках
+func (s *shard) peek(orderUID string, now time.Time) (models.Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.orders[orderUID]
+	if !exists || e.expired(now) {
+		return models.Order{}, false
+	}
+	return e.order, true
+}
+
+// keys возвращает OrderUID всех заказов шарда
+func (s *shard) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uids := make([]string, 0, len(s.orders))
+	for uid := range s.orders {
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+// lookup находит запись, удаляет ее, если она устарела, и учитывает обращение.
+// Вызывается под мьютексом.
+func (s *shard) lookup(orderUID string, now time.Time) *entry {
+	e, exists := s.orders[orderUID]
+	if exists && e.expired(now) {
+		s.remove(e, true)
+		my_prometheus.CacheEvictions.WithLabelValues("ttl").Inc()
+		exists = false
+	}
+	if !exists {
+		my_prometheus.CacheMisses.Inc()
+		return nil
+	}
+
+	my_prometheus.CacheHits.Inc()
+	e.hits++
+	s.counter++
+	e.seq = s.counter
+	s.policy.touch(e)
+	return e
+}
+
+// delete удаляет заказ из шарда
+func (s *shard) delete(orderUID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, exists := s.orders[orderUID]; exists {
+		// Набор заказов по значениям индексов больше не совпадает с БД
+		s.remove(e, true)
+	}
+}
+
+// count возвращает количество заказов в шарде
+func (s *shard) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.orders)
+}
+
+// evict вытесняет устаревшие заказы и освобождает место для нового заказа размером incoming,
+// вызывается под мьютексом
+func (s *shard) evict(now time.Time, incoming int64) {
+	for {
+		victim := s.policy.victim()
+		if victim == nil {
+			// Заказ больше всего бюджета памяти все равно добавляется, чтобы не ходить за ним в БД каждый раз
+			return
+		}
+		var reason string
+		switch {
+		case victim.expired(now):
+			reason = "ttl"
+		case s.maxEntries > 0 && len(s.orders) >= s.maxEntries:
+			reason = "size"
+		case s.maxBytes > 0 && s.bytes+incoming > s.maxBytes:
+			reason = "memory"
+		default:
+			return
+		}
+		s.remove(victim, true)
+		my_prometheus.CacheEvictions.WithLabelValues(reason).Inc()
+	}
+}
+
+// remove удаляет запись из шарда, evicted - запись вытеснена, а не заменена новой версией заказа.
+// Вызывается под мьютексом.
+func (s *shard) remove(e *entry, evicted bool) {
+	s.policy.remove(e)
+	s.index.remove(e.order, evicted)
+	delete(s.orders, e.order.OrderUID)
+	s.bytes -= e.size
+	my_prometheus.CacheEntries.Dec()
+	my_prometheus.CacheBytes.Sub(float64(e.size))
+}
+
+// expired проверяет, истек ли срок жизни записи
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"reflect"
+	"time"
+	"wild_project/src/models"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// orderSize оценивает объем памяти, который занимает заказ вместе с доставкой, оплатой и позициями
+func orderSize(order models.Order) int64 {
+	v := reflect.ValueOf(order)
+	return int64(v.Type().Size()) + indirectSize(v)
+}
+
+// indirectSize считает память, на которую ссылаются поля значения: строки, срезы и указатели
+func indirectSize(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Struct:
+		if v.Type() == timeType {
+			// Часовой пояс общий для всех заказов
+			return 0
+		}
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += indirectSize(v.Field(i))
+		}
+		return size
+	case reflect.Slice:
+		size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += indirectSize(v.Index(i))
+		}
+		return size
+	case reflect.Pointer:
+		if v.IsNil() {
+			return 0
+		}
+		return int64(v.Elem().Type().Size()) + indirectSize(v.Elem())
+	default:
+		return 0
+	}
+}
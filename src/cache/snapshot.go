@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+)
+
+// snapshotVersion версия формата снимка, снимки другой версии не загружаются
+const snapshotVersion = 1
+
+// ErrSnapshotCorrupted контрольная сумма снимка не совпала
+var ErrSnapshotCorrupted = errors.New("снимок кэша поврежден")
+
+// SnapshotInfo сведения о загруженном снимке
+type SnapshotInfo struct {
+	CreatedAt time.Time // Время начала записи снимка
+	Sequence  uint64    // Последний примененный номер сообщения канала на момент снимка
+	Orders    int
+}
+
+// snapshot содержимое файла снимка. Файл состоит из SHA-256 сжатых данных и самих данных в gzip(gob).
+type snapshot struct {
+	Version   int
+	CreatedAt time.Time
+	Sequence  uint64
+	Orders    []models.Order
+}
+
+// WriteSnapshot записывает содержимое кэша в файл. Файл заменяется атомарно,
+// поэтому при падении во время записи остается предыдущий снимок.
+func (oc *OrderCache) WriteSnapshot(path string) error {
+	startTime := time.Now()
+	defer func() {
+		logger.Printf("WriteSnapshot выполнена за %s", time.Since(startTime))
+	}()
+
+	// Номер сообщения читается до заказов: при догоне часть сообщений применится повторно, но ни одно не потеряется
+	data := snapshot{Version: snapshotVersion, CreatedAt: startTime, Sequence: oc.LastSequence()}
+	for _, s := range oc.shards {
+		data.Orders = append(data.Orders, s.snapshot()...)
+	}
+
+	var payload bytes.Buffer
+	zw := gzip.NewWriter(&payload)
+	if err := gob.NewEncoder(zw).Encode(&data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(payload.Bytes())
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(checksum[:]); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(payload.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	logger.Printf("Снимок кэша записан: %d заказов, сообщение %d", len(data.Orders), data.Sequence)
+	return nil
+}
+
+// LoadSnapshot загружает заказы из снимка в кэш и возвращает сведения о нем
+func (oc *OrderCache) LoadSnapshot(path string) (SnapshotInfo, error) {
+	startTime := time.Now()
+	defer func() {
+		logger.Printf("LoadSnapshot выполнена за %s", time.Since(startTime))
+	}()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	if len(raw) < sha256.Size {
+		return SnapshotInfo{}, ErrSnapshotCorrupted
+	}
+	payload := raw[sha256.Size:]
+	if checksum := sha256.Sum256(payload); !bytes.Equal(checksum[:], raw[:sha256.Size]) {
+		return SnapshotInfo{}, ErrSnapshotCorrupted
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer zr.Close()
+	var data snapshot
+	if err := gob.NewDecoder(zr).Decode(&data); err != nil {
+		return SnapshotInfo{}, err
+	}
+	if data.Version != snapshotVersion {
+		return SnapshotInfo{}, fmt.Errorf("неподдерживаемая версия снимка кэша: %d", data.Version)
+	}
+
+	for _, order := range data.Orders {
+		oc.Add(order)
+	}
+	oc.MarkApplied(data.Sequence)
+	logger.Printf("Снимок кэша загружен: %d заказов, сообщение %d", len(data.Orders), data.Sequence)
+	return SnapshotInfo{CreatedAt: data.CreatedAt, Sequence: data.Sequence, Orders: len(data.Orders)}, nil
+}
+
+// RunSnapshots записывает снимок кэша раз в interval, пока не закрыт stop
+func (oc *OrderCache) RunSnapshots(path string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := oc.WriteSnapshot(path); err != nil {
+				logger.Printf("Ошибка записи снимка кэша: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// CatchUpFromDB убирает из кэша заказы, удаленные из БД, и добавляет заказы, измененные в БД начиная с since
+func (oc *OrderCache) CatchUpFromDB(repo repository.OrderRepository, since time.Time) (int, error) {
+	startTime := time.Now()
+	defer func() {
+		logger.Printf("CatchUpFromDB выполнена за %s", time.Since(startTime))
+	}()
+
+	// Удаленные заказы не видны по updated_at, их строк в БД больше нет
+	if _, err := oc.DropDeleted(repo); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err := repo.StreamAll(repository.StreamOptions{UpdatedSince: since}, func(orders []models.Order) error {
+		for _, order := range orders {
+			oc.Add(order)
+		}
+		count += len(orders)
+		return nil
+	})
+	return count, err
+}
+
+// DropDeleted сверяет заказы кэша с БД пачками и удаляет из кэша те, которых в БД уже нет.
+// Возвращает число удаленных заказов.
+func (oc *OrderCache) DropDeleted(repo repository.OrderRepository) (int, error) {
+	uids := oc.Keys()
+	removed := 0
+	for start := 0; start < len(uids); start += repository.DefaultChunkSize {
+		chunk := uids[start:min(start+repository.DefaultChunkSize, len(uids))]
+		stored, err := repo.ExistingUIDs(chunk)
+		if err != nil {
+			return removed, err
+		}
+		exists := make(map[string]bool, len(stored))
+		for _, uid := range stored {
+			exists[uid] = true
+		}
+		for _, uid := range chunk {
+			if !exists[uid] {
+				oc.Remove(uid)
+				removed++
+			}
+		}
+	}
+	if removed > 0 {
+		logger.Printf("Из кэша удалено %d заказов, которых нет в БД", removed)
+	}
+	return removed, nil
+}
+
+// snapshot возвращает заказы шарда от давно запрошенных к недавно запрошенным,
+// чтобы после загрузки снимка вытеснение шло в том же порядке
+func (s *shard) snapshot() []models.Order {
+	type snapshotEntry struct {
+		order models.Order
+		seq   uint64
+	}
+	s.mu.Lock()
+	entries := make([]snapshotEntry, 0, len(s.orders))
+	for _, e := range s.orders {
+		entries = append(entries, snapshotEntry{e.order, e.seq})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	orders := make([]models.Order, len(entries))
+	for i, e := range entries {
+		orders[i] = e.order
+	}
+	return orders
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "snapshots", "cache.snapshot")
+
+	oc := NewOrderCache()
+	for i := 0; i < 20; i++ {
+		order := testOrder(fmt.Sprintf("order-%d", i))
+		order.CustomerID = "customer"
+		oc.Add(order)
+	}
+	oc.MarkApplied(42)
+	oc.MarkApplied(17)
+	assert.NoError(oc.WriteSnapshot(path))
+
+	restored := NewOrderCache()
+	info, err := restored.LoadSnapshot(path)
+	assert.NoError(err)
+	assert.Equal(uint64(42), info.Sequence)
+	assert.Equal(20, info.Orders)
+	assert.Equal(uint64(42), restored.LastSequence())
+	assert.Equal(20, restored.Count())
+
+	order, exists := restored.Get("order-7")
+	assert.True(exists)
+	assert.Equal(testOrder("order-7").Items, order.Items)
+	found, _ := restored.Find(IndexCustomerID, "customer")
+	assert.Len(found, 20, "вторичные индексы восстанавливаются вместе с заказами")
+}
+
+func TestSnapshotChecksum(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	oc := NewOrderCache()
+	oc.Add(testOrder("a"))
+	assert.NoError(oc.WriteSnapshot(path))
+
+	raw, err := os.ReadFile(path)
+	assert.NoError(err)
+	raw[len(raw)-1] ^= 0xff
+	assert.NoError(os.WriteFile(path, raw, 0o644))
+
+	restored := NewOrderCache()
+	_, err = restored.LoadSnapshot(path)
+	assert.ErrorIs(err, ErrSnapshotCorrupted)
+	assert.Equal(0, restored.Count())
+
+	_, err = restored.LoadSnapshot(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestCatchUpFromDB(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	old := testOrder("old")
+	assert.NoError(db.Create(&old).Error)
+	db.Model(&old).UpdateColumn("updated_at", time.Now().Add(-time.Hour))
+
+	since := time.Now().Add(-time.Minute)
+	fresh := testOrder("fresh")
+	assert.NoError(db.Create(&fresh).Error)
+
+	oc := NewOrderCache()
+	count, err := oc.CatchUpFromDB(repository.NewGormRepository(db), since)
+	assert.NoError(err)
+	assert.Equal(1, count)
+	_, exists := oc.Get("fresh")
+	assert.True(exists)
+	_, exists = oc.Get("old")
+	assert.False(exists)
+}
+
+func TestCatchUpFromDBDropsDeletedOrders(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+
+	oc := NewOrderCache()
+	for _, uid := range []string{"kept", "deleted"} {
+		order := testOrder(uid)
+		assert.NoError(repo.Create(&order))
+		oc.Add(order)
+	}
+	assert.NoError(oc.WriteSnapshot(path))
+	assert.NoError(repo.Delete("deleted"))
+
+	restored := NewOrderCache()
+	info, err := restored.LoadSnapshot(path)
+	assert.NoError(err)
+	_, err = restored.CatchUpFromDB(repo, info.CreatedAt)
+	assert.NoError(err)
+
+	_, exists := restored.Get("deleted")
+	assert.False(exists, "заказ, удаленный после снимка, не остается в кэше")
+	_, exists = restored.Get("kept")
+	assert.True(exists)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"wild_project/src/config"
+	"wild_project/src/migrations"
+)
+
+// Управление схемой БД. Сервис стартует, только если применены все миграции сборки:
+//
+//	go run ./src/cmd/migrate status
+//	go run ./src/cmd/migrate up
+//	go run ./src/cmd/migrate down -steps 2
+//	go run ./src/cmd/migrate to 3
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	cmd, err := parseCommand(flag.Args())
+	if err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		usage()
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+	db, err := gorm.Open(postgres.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)})
+	if err != nil {
+		log.Fatalf("Ошибка подключения к базе данных: %v", err)
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Ошибка чтения миграций: %v", err)
+	}
+
+	var done []migrations.Migration
+	switch cmd.name {
+	case "status":
+		printStatus(migrator)
+		return
+	case "up":
+		done, err = migrator.Up()
+	case "down":
+		done, err = migrator.Down(cmd.steps)
+	case "to":
+		done, err = migrator.To(cmd.version)
+	}
+	for _, m := range done {
+		log.Printf("Выполнена миграция %04d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Fatalf("Ошибка миграции: %v", err)
+	}
+	current, err := migrator.Current()
+	if err != nil {
+		log.Fatalf("Ошибка чтения версии схемы: %v", err)
+	}
+	log.Printf("Версия схемы: %d", current)
+}
+
+// command команда migrate с ее параметрами
+type command struct {
+	name    string
+	steps   int // Сколько миграций откатить командой down
+	version int // Целевая версия команды to
+}
+
+func usage() {
+	fmt.Fprintln(flag.CommandLine.Output(), "Использование: migrate status | up | down [-steps N] | to <версия>")
+}
+
+// parseCommand разбирает команду и ее флаги. Флаги команды идут после ее имени, лишние аргументы
+// считаются ошибкой: иначе опечатка в откате схемы молча откатила бы не то количество миграций.
+func parseCommand(args []string) (command, error) {
+	if len(args) == 0 {
+		return command{}, errors.New("не задана команда")
+	}
+	cmd := command{name: args[0]}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	// Ошибку разбора выводит main вместе с общей справкой
+	fs.SetOutput(io.Discard)
+	switch cmd.name {
+	case "status", "up", "to":
+	case "down":
+		fs.IntVar(&cmd.steps, "steps", 1, "сколько последних миграций откатить")
+	default:
+		return command{}, fmt.Errorf("неизвестная команда %q", cmd.name)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return command{}, err
+	}
+
+	rest := fs.Args()
+	if cmd.name == "to" {
+		if len(rest) == 0 {
+			return command{}, errors.New("не задана версия для команды to")
+		}
+		version, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return command{}, fmt.Errorf("некорректная версия %q", rest[0])
+		}
+		cmd.version = version
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		return command{}, fmt.Errorf("лишние аргументы команды %s: %v", cmd.name, rest)
+	}
+	if cmd.name == "down" && cmd.steps < 1 {
+		return command{}, fmt.Errorf("некорректное количество миграций: %d", cmd.steps)
+	}
+	return cmd, nil
+}
+
+// printStatus выводит миграции сборки и БД с отметкой о применении
+func printStatus(migrator *migrations.Migrator) {
+	statuses, err := migrator.Status()
+	if err != nil {
+		log.Fatalf("Ошибка чтения состояния миграций: %v", err)
+	}
+	for _, s := range statuses {
+		state := "не применена"
+		if s.Applied {
+			state = "применена " + s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if !s.Known {
+			state += ", нет в сборке"
+		}
+		fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+	}
+	if err := migrator.Check(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd, err := parseCommand([]string{"down", "-steps", "2"})
+	assert.NoError(err)
+	assert.Equal(command{name: "down", steps: 2}, cmd)
+
+	cmd, err = parseCommand([]string{"down"})
+	assert.NoError(err)
+	assert.Equal(command{name: "down", steps: 1}, cmd)
+
+	cmd, err = parseCommand([]string{"to", "3"})
+	assert.NoError(err)
+	assert.Equal(command{name: "to", version: 3}, cmd)
+
+	cmd, err = parseCommand([]string{"up"})
+	assert.NoError(err)
+	assert.Equal(command{name: "up"}, cmd)
+
+	for _, args := range [][]string{
+		nil,
+		{"sideways"},
+		{"down", "2"},
+		{"down", "-steps", "0"},
+		{"down", "-steps", "2", "extra"},
+		{"up", "-steps", "2"},
+		{"status", "now"},
+		{"to"},
+		{"to", "three"},
+		{"to", "3", "4"},
+	} {
+		_, err := parseCommand(args)
+		assert.Error(err, "%v", args)
+	}
+}
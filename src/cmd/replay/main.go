@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"log"
+	"os"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/config"
+	"wild_project/src/history"
+	"wild_project/src/invalidation"
+	"wild_project/src/migrations"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/replay"
+	"wild_project/src/repository"
+)
+
+// Повторное чтение канала заказов, например после исправления валидации:
+//
+//	go run ./src/cmd/replay -seq 100 -dry-run
+//	go run ./src/cmd/replay -since 2024-01-02T15:04:05Z
+func main() {
+	seq := flag.Uint64("seq", 0, "начать с сообщения с этим порядковым номером")
+	since := flag.String("since", "", "начать с сообщений, опубликованных не раньше этого времени (RFC3339)")
+	dryRun := flag.Bool("dry-run", false, "только проверить заказы, ничего не записывая в БД")
+	idle := flag.Duration("idle", replay.DefaultIdleTimeout, "завершить чтение, если за это время не пришло ни одного сообщения")
+	flag.Parse()
+	if *idle <= 0 {
+		log.Fatalf("Некорректное время ожидания -idle %s: должно быть больше нуля", *idle)
+	}
+
+	cfg := config.Load()
+	opts := replay.Options{
+		Channel:       cfg.Channel,
+		StartSequence: *seq,
+		DryRun:        *dryRun,
+		IdleTimeout:   *idle,
+	}
+	if *since != "" {
+		t, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			log.Fatalf("Некорректное время %q: %v", *since, err)
+		}
+		opts.StartTime = t
+	}
+
+	db, err := gorm.Open(postgres.Open(cfg.DatabaseDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)})
+	if err != nil {
+		log.Fatalf("Ошибка подключения к базе данных: %v", err)
+	}
+	// Как и сервис, команда пишет заказы только в схему, соответствующую сборке
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Ошибка чтения миграций: %v", err)
+	}
+	if err := migrator.Check(); err != nil {
+		log.Fatalf("Схема БД не готова, выполните go run ./src/cmd/migrate up: %v", err)
+	}
+
+	// Отдельный ID клиента, чтобы не конфликтовать с работающим сервисом
+	cfg.Broker.ClientID += "-replay"
+	broker, err := natsclient.NewBroker(cfg.Broker)
+	if err != nil {
+		log.Fatalf("Ошибка подключения к брокеру: %v", err)
+	}
+	defer broker.Close()
+
+	orders, err := repository.New(cfg.StorageBackend, db)
+	if err != nil {
+		log.Fatalf("Ошибка в настройках хранилища заказов: %v", err)
+	}
+	// Изменения при повторном чтении попадают в историю заказов, как и при обычной обработке
+	repo, err := history.Wrap(orders, history.NewStore(db))
+	if err != nil {
+		log.Fatalf("Ошибка подключения истории заказов: %v", err)
+	}
+	// Работающие реплики перечитывают измененные заказы и узнают о новых по событиям кэша
+	var orderCache cache.Cache = cache.NewOrderCache()
+	if cfg.CacheEventsSubject != "off" {
+		orderCache = invalidation.New(orderCache, broker, repo, cfg.CacheEventsSubject)
+	}
+	report, err := replay.Run(broker, orderCache, repo, opts)
+	if err != nil {
+		log.Fatalf("Ошибка повторного чтения: %v", err)
+	}
+	json.NewEncoder(os.Stdout).Encode(report)
+}
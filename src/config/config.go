@@ -0,0 +1,120 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+	"wild_project/src/cache"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
+)
+
+// Config параметры сервиса, значения по умолчанию можно переопределить переменными окружения
+type Config struct {
+	DatabaseDSN        string
+	StorageBackend     string // Способ хранения заказов: relational - по таблицам, document - JSONB документом
+	Broker             natsclient.BrokerConfig
+	Channel            string        // Канал с заказами
+	DurableName        string        // Имя durable подписки на канал заказов
+	QueueGroup         string        // Группа реплик, которые делят канал заказов, пустая - каждая реплика получает все сообщения
+	AckWait            time.Duration // Время ожидания подтверждения до повторной доставки
+	DLQChannel         string        // Канал для сообщений, которые не удалось обработать
+	MaxRedeliveries    uint32        // Лимит повторных доставок до отправки в карантин
+	IngestMode         string        // pool - параллельная обработка по одному заказу, batch - запись пачками
+	Workers            int           // Количество параллельных обработчиков заказов
+	MaxInflight        int           // Максимум неподтвержденных сообщений в обработке
+	BatchSize          int           // Размер пачки в режиме batch
+	BatchInterval      time.Duration // Максимальное время накопления пачки в режиме batch
+	Cache              cache.Config  // Политика вытеснения и ограничения кэша заказов
+	SnapshotPath       string        // Файл снимка кэша, off - снимки отключены
+	SnapshotInterval   time.Duration // Период записи снимка кэша
+	SnapshotCatchUp    string        // Как догнать изменения после снимка: db - запросом к БД, replay - перечитав канал
+	CacheEventsSubject string        // Тема для событий кэша между репликами, off - события отключены
+	AuditInterval      time.Duration // Период фоновой проверки кэша по БД, 0 - проверка отключена
+	AuditSample        int           // Сколько случайных заказов проверять за раз, 0 - все
+	AuditRepair        bool          // Исправлять найденные расхождения при фоновой проверке
+}
+
+// Load читает конфигурацию из переменных окружения
+func Load() Config {
+	cfg := Config{
+		DatabaseDSN:    getEnv("DATABASE_DSN", "user=admin password=root dbname=mydatabase sslmode=disable host=localhost port=5433"),
+		StorageBackend: getEnv("STORAGE_BACKEND", repository.BackendRelational),
+		Broker: natsclient.BrokerConfig{
+			Backend:   getEnv("BROKER_BACKEND", natsclient.BackendSTAN),
+			URL:       getEnv("NATS_URL", "nats://localhost:4222"),
+			ClusterID: getEnv("NATS_CLUSTER_ID", "my_cluster"),
+			ClientID:  getEnv("NATS_CLIENT_ID", "client-123"), // У каждой реплики должен быть свой ID
+			Stream:    getEnv("JETSTREAM_STREAM", "ORDERS"),
+		},
+		Channel:         getEnv("NATS_CHANNEL", "tests-channel"),
+		DurableName:     getEnv("NATS_DURABLE_NAME", "my-durable"),
+		QueueGroup:      getEnv("NATS_QUEUE_GROUP", ""),
+		AckWait:         getEnvDuration("ACK_WAIT", 30*time.Second),
+		DLQChannel:      getEnv("DLQ_CHANNEL", "tests-channel-dlq"),
+		MaxRedeliveries: uint32(getEnvInt("MAX_REDELIVERIES", 5)),
+		IngestMode:      getEnv("INGEST_MODE", "pool"),
+		Workers:         getEnvInt("INGEST_WORKERS", 4),
+		MaxInflight:     getEnvInt("MAX_INFLIGHT", 64),
+		BatchSize:       getEnvInt("BATCH_SIZE", 50),
+		BatchInterval:   getEnvDuration("BATCH_INTERVAL", 200*time.Millisecond),
+		Cache: cache.Config{
+			Backend:    getEnv("CACHE_BACKEND", cache.BackendMemory),
+			RedisURL:   getEnv("REDIS_URL", "redis://localhost:6379/0"),
+			Policy:     getEnv("CACHE_POLICY", cache.PolicyLRU), // lru, lfu или ttl
+			Shards:     getEnvInt("CACHE_SHARDS", 16),
+			MaxEntries: getEnvInt("CACHE_MAX_ENTRIES", 100000),
+			MaxBytes:   int64(getEnvInt("CACHE_MAX_BYTES", 256<<20)),
+			TTL:        getEnvDuration("CACHE_TTL", 0),
+			Gzip:       getEnvBool("CACHE_GZIP", true),
+			MissingTTL: getEnvDuration("CACHE_MISSING_TTL", 5*time.Second),
+		},
+		SnapshotPath:       getEnv("CACHE_SNAPSHOT_PATH", "data/cache.snapshot"),
+		SnapshotInterval:   getEnvDuration("CACHE_SNAPSHOT_INTERVAL", time.Minute),
+		SnapshotCatchUp:    getEnv("CACHE_SNAPSHOT_CATCHUP", "db"),
+		CacheEventsSubject: getEnv("CACHE_EVENTS_SUBJECT", "order-cache-events"),
+		AuditInterval:      getEnvDuration("AUDIT_INTERVAL", 10*time.Minute),
+		AuditSample:        getEnvInt("AUDIT_SAMPLE", 1000),
+		AuditRepair:        getEnvBool("AUDIT_REPAIR", false),
+	}
+	// События кэша нужны только репликам, которые работают сейчас, хранить их в потоке с заказами незачем
+	if cfg.CacheEventsSubject != "off" {
+		cfg.Broker.TransientSubjects = []string{cfg.CacheEventsSubject}
+	}
+	return cfg
+}
+
+// getEnv возвращает значение переменной окружения или значение по умолчанию
+func getEnv(key string, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvInt возвращает числовое значение переменной окружения или значение по умолчанию
+func getEnvInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// getEnvDuration возвращает длительность из переменной окружения (например 30s) или значение по умолчанию
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// getEnvBool возвращает логическое значение переменной окружения (true, false, 1, 0) или значение по умолчанию
+func getEnvBool(key string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,132 @@
+package deadletter
+
+import (
+	"gopkg.in/natefinch/lumberjack.v2"
+	"gorm.io/gorm"
+	"log"
+	"wild_project/src/models"
+	natsclient "wild_project/src/nats"
+)
+
+var logger *log.Logger
+var filePath = "logs/deadletter.log"
+
+func init() {
+	logger = log.New(&lumberjack.Logger{
+		Filename:   filePath,
+		MaxSize:    10, // Размер файла в мегабайтах до ротации
+		MaxBackups: 3,  // Максимальное количество старых файлов логов
+		MaxAge:     28, // Максимальное количество дней для хранения логов
+		Compress:   true,
+	}, "DEADLETTER: ", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// Publisher публикует сообщение в канал NATS
+type Publisher interface {
+	PublishMessage(topic string, message []byte) error
+}
+
+// Queue отправляет необработанные сообщения в DLQ канал и хранит их в таблице карантина
+type Queue struct {
+	db              *gorm.DB
+	publisher       Publisher
+	channel         string
+	MaxRedeliveries uint32 // Количество повторных доставок, после которого сообщение отправляется в карантин
+}
+
+// NewQueue создает новый экземпляр Queue
+func NewQueue(db *gorm.DB, publisher Publisher, channel string, maxRedeliveries uint32) *Queue {
+	return &Queue{
+		db:              db,
+		publisher:       publisher,
+		channel:         channel,
+		MaxRedeliveries: maxRedeliveries,
+	}
+}
+
+// Put сохраняет сообщение в карантин вместе с причиной ошибки и публикует его в DLQ канал.
+// Публикация выполняется последней в транзакции записи: если она не удалась, запись откатывается,
+// и повторная доставка сообщения не оставит в карантине и DLQ дубликатов.
+// Если вернулась ошибка, сообщение не должно подтверждаться.
+func (q *Queue) Put(m *natsclient.Message, reason error) error {
+	msg := models.QuarantinedMessage{
+		Channel:         m.Subject,
+		Data:            m.Data,
+		Sequence:        m.Sequence,
+		RedeliveryCount: m.RedeliveryCount,
+		Reason:          reason.Error(),
+	}
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&msg).Error; err != nil {
+			logger.Printf("Ошибка сохранения сообщения %d в карантин: %v", m.Sequence, err)
+			return err
+		}
+		if err := q.publisher.PublishMessage(q.channel, m.Data); err != nil {
+			logger.Printf("Ошибка публикации сообщения %d в DLQ: %v", m.Sequence, err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.Printf("Сообщение %d из канала %s помещено в карантин: %v", m.Sequence, m.Subject, reason)
+	return nil
+}
+
+// List возвращает все сообщения из карантина
+func (q *Queue) List() ([]models.QuarantinedMessage, error) {
+	var msgs []models.QuarantinedMessage
+	if err := q.db.Order("id").Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// Get возвращает сообщение из карантина по его ID
+func (q *Queue) Get(id uint) (models.QuarantinedMessage, error) {
+	var msg models.QuarantinedMessage
+	if err := q.db.First(&msg, id).Error; err != nil {
+		return models.QuarantinedMessage{}, err
+	}
+	return msg, nil
+}
+
+// Replay удаляет сообщение из карантина и повторно публикует его в исходный канал.
+// Строка удаляется из таблицы насовсем через Unscoped, а не помечается удаленной gorm.Model.
+// Публикация выполняется последней в транзакции удаления: если удаление не удалось,
+// сообщение не публикуется, а если не удалась публикация, оно остается в карантине.
+func (q *Queue) Replay(id uint) error {
+	var msg models.QuarantinedMessage
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&msg, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&msg).Error; err != nil {
+			return err
+		}
+		if err := q.publisher.PublishMessage(msg.Channel, msg.Data); err != nil {
+			logger.Printf("Ошибка повторной публикации сообщения %d: %v", id, err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.Printf("Сообщение %d повторно опубликовано в канал %s", id, msg.Channel)
+	return nil
+}
+
+// Discard удаляет сообщение из карантина без повторной публикации.
+// Как и в Replay, строка удаляется насовсем, чтобы таблица карантина не росла.
+func (q *Queue) Discard(id uint) error {
+	if _, err := q.Get(id); err != nil {
+		return err
+	}
+	if err := q.db.Unscoped().Delete(&models.QuarantinedMessage{}, id).Error; err != nil {
+		return err
+	}
+	logger.Printf("Сообщение %d удалено из карантина", id)
+	return nil
+}
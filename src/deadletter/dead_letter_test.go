@@ -0,0 +1,117 @@
+package deadletter
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+	"wild_project/src/models"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/tests/testdb"
+)
+
+// recordingPublisher запоминает опубликованные сообщения или возвращает ошибку err
+type recordingPublisher struct {
+	err       error
+	published []string
+}
+
+func (p *recordingPublisher) PublishMessage(topic string, message []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, topic+":"+string(message))
+	return nil
+}
+
+// countQuarantined считает строки карантина вместе с помеченными удаленными
+func countQuarantined(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	assert.NoError(t, db.Unscoped().Model(&models.QuarantinedMessage{}).Count(&count).Error)
+	return count
+}
+
+func TestPut(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	publisher := &recordingPublisher{err: errors.New("брокер недоступен")}
+	q := NewQueue(db, publisher, "orders-dlq", 5)
+	m := &natsclient.Message{Subject: "orders", Data: []byte("bad"), Sequence: 7}
+
+	// Сообщение, которое не удалось опубликовать в DLQ, не остается в карантине
+	assert.Error(q.Put(m, errors.New("некорректный заказ")))
+	assert.Equal(int64(0), countQuarantined(t, db))
+
+	// Повторная доставка не создает дубликатов
+	publisher.err = nil
+	assert.NoError(q.Put(m, errors.New("некорректный заказ")))
+	assert.Equal([]string{"orders-dlq:bad"}, publisher.published)
+	msgs, err := q.List()
+	assert.NoError(err)
+	if assert.Len(msgs, 1) {
+		assert.Equal("orders", msgs[0].Channel)
+		assert.Equal(uint64(7), msgs[0].Sequence)
+		assert.Equal("некорректный заказ", msgs[0].Reason)
+	}
+}
+
+func TestPutWithoutStore(t *testing.T) {
+	db := testdb.Open(t)
+	assert.NoError(t, db.Migrator().DropTable(&models.QuarantinedMessage{}))
+	publisher := &recordingPublisher{}
+	q := NewQueue(db, publisher, "orders-dlq", 5)
+
+	// Сообщение, которое не удалось сохранить, не публикуется в DLQ
+	assert.Error(t, q.Put(&natsclient.Message{Subject: "orders", Data: []byte("bad")}, errors.New("некорректный заказ")))
+	assert.Empty(t, publisher.published)
+}
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	publisher := &recordingPublisher{}
+	q := NewQueue(db, publisher, "orders-dlq", 5)
+	assert.NoError(q.Put(&natsclient.Message{Subject: "orders", Data: []byte("bad")}, errors.New("некорректный заказ")))
+	msgs, err := q.List()
+	assert.NoError(err)
+	id := msgs[0].ID
+	publisher.published = nil
+
+	// Если публикация не удалась, сообщение остается в карантине
+	publisher.err = errors.New("брокер недоступен")
+	assert.Error(q.Replay(id))
+	assert.Equal(int64(1), countQuarantined(t, db))
+
+	// Если не удалось удаление, сообщение не публикуется
+	publisher.err = nil
+	failDelete := errors.New("удаление запрещено")
+	assert.NoError(db.Callback().Delete().Before("gorm:delete").Register("test:fail_delete", func(tx *gorm.DB) {
+		tx.AddError(failDelete)
+	}))
+	assert.ErrorIs(q.Replay(id), failDelete)
+	assert.Empty(publisher.published)
+	assert.NoError(db.Callback().Delete().Remove("test:fail_delete"))
+
+	assert.NoError(q.Replay(id))
+	assert.Equal([]string{"orders:bad"}, publisher.published)
+	assert.Equal(int64(0), countQuarantined(t, db))
+	_, err = q.Get(id)
+	assert.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func TestDiscard(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	publisher := &recordingPublisher{}
+	q := NewQueue(db, publisher, "orders-dlq", 5)
+	assert.NoError(q.Put(&natsclient.Message{Subject: "orders", Data: []byte("bad")}, errors.New("некорректный заказ")))
+	msgs, err := q.List()
+	assert.NoError(err)
+	publisher.published = nil
+
+	// Строка удаляется из таблицы, а не помечается удаленной, и сообщение не публикуется
+	assert.NoError(q.Discard(msgs[0].ID))
+	assert.Equal(int64(0), countQuarantined(t, db))
+	assert.Empty(publisher.published)
+	assert.ErrorIs(q.Discard(msgs[0].ID), gorm.ErrRecordNotFound)
+}
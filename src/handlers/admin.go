@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"wild_project/src/audit"
+	"wild_project/src/cache"
+	"wild_project/src/history"
+	"wild_project/src/repository"
+)
+
+// RegisterAdminHandlers регистрирует служебные обработчики для работы с заказами
+func RegisterAdminHandlers(oc cache.Cache, repo repository.OrderRepository) {
+	// Удаление заказа из БД и кэшей всех реплик
+	http.HandleFunc("/admin/order/delete", deleteOrderHandler(oc, repo))
+}
+
+// deleteOrderHandler удаляет заказ с id из запроса
+func deleteOrderHandler(oc cache.Cache, repo repository.OrderRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		orderID := r.URL.Query().Get("id")
+		if orderID == "" {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+
+		if err := repository.WithSource(repo, history.HTTPSource(requestID(w, r))).Delete(orderID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				http.Error(w, "Order не найден", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Ошибка в БД", http.StatusInternalServerError)
+			logger.Printf("Ошибка удаления заказа %s: %v", orderID, err)
+			return
+		}
+		oc.Remove(orderID)
+		logger.Printf("Заказ удален: %s", orderID)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Order deleted"))
+	}
+}
+
+// RegisterAuditHandler регистрирует проверку кэша по БД:
+// /admin/cache/audit?sample=N проверяет N случайных заказов кэша, без sample - все.
+// С repair=true расхождения исправляются, такой запрос должен быть POST.
+func RegisterAuditHandler(a *audit.Auditor) {
+	http.HandleFunc("/admin/cache/audit", auditHandler(a))
+}
+
+// auditHandler запускает проверку кэша и возвращает отчет в JSON
+func auditHandler(a *audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var opts audit.Options
+		query := r.URL.Query()
+		if v := query.Get("sample"); v != "" {
+			sample, err := strconv.Atoi(v)
+			if err != nil || sample < 0 {
+				http.Error(w, "Invalid sample", http.StatusBadRequest)
+				return
+			}
+			opts.Sample = sample
+		}
+		if v := query.Get("repair"); v != "" {
+			repair, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "Invalid repair", http.StatusBadRequest)
+				return
+			}
+			opts.Repair = repair
+		}
+		if opts.Repair && r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed for repair", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report, err := a.Run(opts)
+		if err != nil {
+			if errors.Is(err, audit.ErrRunning) {
+				http.Error(w, "Проверка уже выполняется", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Ошибка в БД", http.StatusInternalServerError)
+			logger.Printf("Ошибка проверки кэша: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
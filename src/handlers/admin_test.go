@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wild_project/src/audit"
+	"wild_project/src/cache"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+func TestDeleteOrderHandler(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	order := models.Order{OrderUID: "a", Items: []models.Items{{ChrtID: 1}}}
+	assert.NoError(db.Create(&order).Error)
+	oc := cache.NewOrderCache()
+	oc.Add(order)
+
+	handler := deleteOrderHandler(oc, repo)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/order/delete?id=a", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+
+	_, exists := oc.Get("a")
+	assert.False(exists)
+	var items int64
+	db.Model(&models.Items{}).Count(&items)
+	assert.Equal(int64(0), items)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/order/delete?id=a", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/order/delete?id=a", nil))
+	assert.Equal(http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestAuditHandler(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	oc := cache.NewOrderCache()
+	oc.Add(models.Order{OrderUID: "deleted"})
+	handler := auditHandler(audit.New(oc, repo))
+	run := func(method, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, "/admin/cache/audit"+query, nil))
+		return rec
+	}
+
+	rec := run(http.MethodGet, "")
+	assert.Equal(http.StatusOK, rec.Code)
+	var report audit.Report
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&report))
+	if assert.Len(report.Divergences, 1) {
+		assert.Equal(audit.KindMissingDB, report.Divergences[0].Kind)
+	}
+
+	assert.Equal(http.StatusMethodNotAllowed, run(http.MethodGet, "?repair=true").Code)
+	assert.Equal(http.StatusBadRequest, run(http.MethodGet, "?sample=-1").Code)
+	assert.Equal(http.StatusOK, run(http.MethodPost, "?repair=true&sample=10").Code)
+	assert.Equal(0, oc.Count())
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"wild_project/src/deadletter"
+)
+
+// RegisterDeadLetterHandlers регистрирует обработчики для просмотра и разбора карантина сообщений
+func RegisterDeadLetterHandlers(q *deadletter.Queue) {
+	http.HandleFunc("/dlq", dlqListHandler(q))
+	http.HandleFunc("/dlq/message", dlqMessageHandler(q))
+	http.HandleFunc("/dlq/replay", dlqReplayHandler(q))
+	http.HandleFunc("/dlq/discard", dlqDiscardHandler(q))
+}
+
+// dlqListHandler возвращает список сообщений в карантине
+func dlqListHandler(q *deadletter.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		msgs, err := q.List()
+		if err != nil {
+			http.Error(w, "Ошибка в БД", http.StatusInternalServerError)
+			logger.Printf("Ошибка получения карантина: %v", err)
+			return
+		}
+		json.NewEncoder(w).Encode(msgs)
+	}
+}
+
+// dlqMessageHandler возвращает одно сообщение из карантина
+func dlqMessageHandler(q *deadletter.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, ok := parseQuarantineID(w, r)
+		if !ok {
+			return
+		}
+		msg, err := q.Get(id)
+		if err != nil {
+			writeQuarantineError(w, id, err)
+			return
+		}
+		json.NewEncoder(w).Encode(msg)
+	}
+}
+
+// dlqReplayHandler повторно публикует сообщение в исходный канал
+func dlqReplayHandler(q *deadletter.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, ok := parseQuarantineID(w, r)
+		if !ok {
+			return
+		}
+		if err := q.Replay(id); err != nil {
+			writeQuarantineError(w, id, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Message replayed"))
+	}
+}
+
+// dlqDiscardHandler удаляет сообщение из карантина
+func dlqDiscardHandler(q *deadletter.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, ok := parseQuarantineID(w, r)
+		if !ok {
+			return
+		}
+		if err := q.Discard(id); err != nil {
+			writeQuarantineError(w, id, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Message discarded"))
+	}
+}
+
+// parseQuarantineID извлекает ID сообщения из параметра id запроса
+func parseQuarantineID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writeQuarantineError отвечает клиенту в зависимости от типа ошибки
+func writeQuarantineError(w http.ResponseWriter, id uint, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Сообщение не найдено", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Ошибка обработки сообщения", http.StatusInternalServerError)
+	logger.Printf("Ошибка обработки сообщения карантина %d: %v", id, err)
+}
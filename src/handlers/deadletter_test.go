@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"wild_project/src/deadletter"
+	"wild_project/src/models"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/tests/testdb"
+)
+
+func TestDeadLetterHandlers(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+	q := deadletter.NewQueue(db, broker, "orders-dlq", 5)
+	assert.NoError(q.Put(&natsclient.Message{Subject: "orders", Data: []byte("bad"), Sequence: 3}, errors.New("некорректный заказ")))
+	run := func(handler http.HandlerFunc, method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := run(dlqListHandler(q), http.MethodGet, "/dlq")
+	assert.Equal(http.StatusOK, rec.Code)
+	var msgs []models.QuarantinedMessage
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&msgs))
+	if !assert.Len(msgs, 1) {
+		return
+	}
+	id := msgs[0].ID
+	query := "?id=" + strconv.FormatUint(uint64(id), 10)
+
+	rec = run(dlqMessageHandler(q), http.MethodGet, "/dlq/message"+query)
+	assert.Equal(http.StatusOK, rec.Code)
+	var msg models.QuarantinedMessage
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&msg))
+	assert.Equal("bad", string(msg.Data))
+	assert.Equal("некорректный заказ", msg.Reason)
+
+	// Неизвестный id, некорректный id и неверный метод
+	for _, handler := range []http.HandlerFunc{dlqReplayHandler(q), dlqDiscardHandler(q)} {
+		assert.Equal(http.StatusNotFound, run(handler, http.MethodPost, "/dlq/x?id=999").Code)
+		assert.Equal(http.StatusBadRequest, run(handler, http.MethodPost, "/dlq/x?id=abc").Code)
+		assert.Equal(http.StatusMethodNotAllowed, run(handler, http.MethodGet, "/dlq/x"+query).Code)
+	}
+	assert.Equal(http.StatusNotFound, run(dlqMessageHandler(q), http.MethodGet, "/dlq/message?id=999").Code)
+	assert.Equal(http.StatusMethodNotAllowed, run(dlqMessageHandler(q), http.MethodPost, "/dlq/message"+query).Code)
+	assert.Equal(http.StatusMethodNotAllowed, run(dlqListHandler(q), http.MethodPost, "/dlq").Code)
+
+	// Повторная публикация отправляет сообщение в исходный канал и убирает его из карантина
+	replayed := make(chan *natsclient.Message, 1)
+	assert.NoError(broker.Subscribe("orders", func(m *natsclient.Message) error {
+		replayed <- m
+		return nil
+	}, natsclient.DeliverNewOnly()))
+	rec = run(dlqReplayHandler(q), http.MethodPost, "/dlq/replay"+query)
+	assert.Equal(http.StatusOK, rec.Code)
+	select {
+	case m := <-replayed:
+		assert.Equal("bad", string(m.Data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Сообщение не опубликовано в исходный канал")
+	}
+	assert.Equal(http.StatusNotFound, run(dlqMessageHandler(q), http.MethodGet, "/dlq/message"+query).Code)
+
+	// Удаление без повторной публикации
+	assert.NoError(q.Put(&natsclient.Message{Subject: "orders", Data: []byte("worse")}, errors.New("некорректный заказ")))
+	rec = run(dlqListHandler(q), http.MethodGet, "/dlq")
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&msgs))
+	if assert.Len(msgs, 1) {
+		assert.NotEqual(id, msgs[0].ID)
+		assert.Equal(http.StatusOK, run(dlqDiscardHandler(q), http.MethodPost, "/dlq/discard?id="+strconv.FormatUint(uint64(msgs[0].ID), 10)).Code)
+	}
+	rec = run(dlqListHandler(q), http.MethodGet, "/dlq")
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&msgs))
+	assert.Empty(msgs)
+}
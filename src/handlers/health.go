@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	natsclient "wild_project/src/nats"
+)
+
+// RegisterHealthHandler регистрирует обработчик /health с состоянием соединения с брокером
+func RegisterHealthHandler(broker natsclient.Broker) {
+	http.HandleFunc("/health", healthHandler(broker))
+}
+
+// healthHandler отвечает 200, если соединение с брокером установлено, и 503, если нет
+func healthHandler(broker natsclient.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := map[string]string{"broker": "connected"}
+		code := http.StatusOK
+		if !broker.IsConnected() {
+			status["broker"] = "disconnected"
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	natsclient "wild_project/src/nats"
+)
+
+// switchableBroker брокер в памяти, состояние соединения которого задает тест
+type switchableBroker struct {
+	*natsclient.MemoryBroker
+	connected bool
+}
+
+func (b *switchableBroker) IsConnected() bool {
+	return b.connected
+}
+
+func TestHealthHandler(t *testing.T) {
+	assert := assert.New(t)
+	broker := &switchableBroker{MemoryBroker: natsclient.NewMemoryBroker(), connected: true}
+	defer broker.Close()
+	handler := healthHandler(broker)
+	check := func() (int, map[string]string) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var status map[string]string
+		assert.NoError(json.NewDecoder(rec.Body).Decode(&status))
+		return rec.Code, status
+	}
+
+	code, status := check()
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("connected", status["broker"])
+
+	broker.connected = false
+	code, status = check()
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal("disconnected", status["broker"])
+
+	broker.connected = true
+	code, _ = check()
+	assert.Equal(http.StatusOK, code)
+}
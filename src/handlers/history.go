@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"wild_project/src/history"
+)
+
+// requestID возвращает идентификатор запроса из заголовка X-Request-ID или создает новый.
+// Идентификатор возвращается клиенту, чтобы по нему можно было найти изменение в истории заказа.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get("X-Request-ID")
+	if id == "" {
+		buf := make([]byte, 8)
+		rand.Read(buf)
+		id = hex.EncodeToString(buf)
+	}
+	w.Header().Set("X-Request-ID", id)
+	return id
+}
+
+// RegisterHistoryHandler регистрирует историю изменений заказа: GET /orders/{uid}/history
+func RegisterHistoryHandler(store *history.Store) {
+	http.HandleFunc("/orders/", historyHandler(store))
+}
+
+// historyHandler возвращает историю заказа с изменениями полей в JSON
+func historyHandler(store *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orderID, found := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/orders/"), "/history")
+		if !found || orderID == "" || strings.Contains(orderID, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		events, err := store.Timeline(orderID)
+		if err != nil {
+			http.Error(w, "Ошибка в БД", http.StatusInternalServerError)
+			logger.Printf("Ошибка чтения истории заказа %s: %v", orderID, err)
+			return
+		}
+		if len(events) == 0 {
+			http.Error(w, "История заказа не найдена", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			OrderUID string          `json:"order_uid"`
+			Events   []history.Event `json:"events"`
+		}{orderID, events})
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wild_project/src/cache"
+	"wild_project/src/history"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+func TestHistoryHandler(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	store := history.NewStore(db)
+	repo, err := history.Wrap(repository.NewGormRepository(db), store)
+	require.NoError(t, err)
+
+	order := models.Order{OrderUID: "a", Version: 1, Delivery: models.Delivery{City: "Moscow"}}
+	assert.NoError(repository.WithSource(repo, history.NATSSource(7)).Create(&order))
+	next := models.Order{OrderUID: "a", Version: 2, Delivery: models.Delivery{City: "Kazan"}}
+	assert.NoError(repository.WithSource(repo, history.NATSSource(8)).Upsert(&next))
+
+	// Удаление через служебный обработчик приписывается id запроса
+	req := httptest.NewRequest(http.MethodPost, "/admin/order/delete?id=a", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	rec := httptest.NewRecorder()
+	deleteOrderHandler(cache.NewOrderCache(), repo)(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("req-42", rec.Header().Get("X-Request-ID"))
+
+	handler := historyHandler(store)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/orders/a/history", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	var body struct {
+		OrderUID string          `json:"order_uid"`
+		Events   []history.Event `json:"events"`
+	}
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal("a", body.OrderUID)
+	if assert.Len(body.Events, 3) {
+		assert.Equal("nats:7", body.Events[0].Source)
+		assert.Equal(history.ActionCreated, body.Events[0].Action)
+		assert.Equal(history.ActionUpdated, body.Events[1].Action)
+		assert.Equal([]models.Change{
+			{Path: "delivery.City", Old: "Moscow", New: "Kazan"},
+			{Path: "Version", Old: float64(1), New: float64(2)},
+		}, body.Events[1].Changes)
+		assert.Equal("http:req-42", body.Events[2].Source)
+		assert.Equal(history.ActionDeleted, body.Events[2].Action)
+		assert.Equal("Kazan", body.Events[2].Order.Delivery.City)
+	}
+
+	for path, code := range map[string]int{
+		"/orders/missing/history": http.StatusNotFound,
+		"/orders/a":               http.StatusNotFound,
+		"/orders/a/b/history":     http.StatusNotFound,
+	} {
+		rec = httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(code, rec.Code, path)
+	}
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/orders/a/history", nil))
+	assert.Equal(http.StatusMethodNotAllowed, rec.Code)
+}
@@ -2,16 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
-	"errors"
 	"gopkg.in/natefinch/lumberjack.v2"
-	"gorm.io/gorm"
 	"log"
 	"net/http"
-	"time"
 	"wild_project/src/cache"
-	"wild_project/src/models"
-	"wild_project/src/my_prometheus"
 	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
 )
 
 var logger *log.Logger
@@ -30,67 +26,13 @@ func init() {
 var path = "/Users/tarasmalinovskij/my_project/src/static"
 
 // StartServer запускает HTTP-сервер
-func StartServer(oc *cache.OrderCache, db *gorm.DB, natsClient *natsclient.NatsClient, port string) error {
+func StartServer(oc cache.Cache, repo repository.OrderRepository, natsClient natsclient.Broker, port string) error {
 	// Обслуживание статических файлов
 	fs := http.FileServer(http.Dir(path))
 	http.Handle("/", fs)
 
 	// Обработчик API для получения информации о заказе
-	http.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
-		overallStart := time.Now()
-
-		// Извлечение ID заказа из запроса
-		orderID := r.URL.Query().Get("id")
-		logger.Printf("Получен запрос на заказ с ID: %s", orderID)
-
-		// Получение данных заказа из кэша
-		cacheStart := time.Now()
-		if order, exists := oc.Get(orderID); exists {
-			cacheDuration := time.Since(cacheStart).Seconds()
-			my_prometheus.CacheResponseTime.WithLabelValues("/order").Observe(cacheDuration)
-
-			json.NewEncoder(w).Encode(order)
-			logger.Printf("Найден в кеше ID: %s", orderID)
-
-			overallDuration := time.Since(overallStart).Seconds()
-			my_prometheus.OverallResponseTime.WithLabelValues("/order").Observe(overallDuration)
-			my_prometheus.TotalRequests.WithLabelValues("/order").Inc()
-			return
-		}
-		cacheDuration := time.Since(cacheStart).Seconds()
-		my_prometheus.CacheResponseTime.WithLabelValues("/order").Observe(cacheDuration)
-
-		// Если заказ не найден в кэше, идем в базу данных
-		dbStart := time.Now()
-		var order models.Order
-		if err := db.Where("order_uid = ?", orderID).First(&order).Error; err != nil {
-			dbDuration := time.Since(dbStart).Seconds()
-			my_prometheus.DbResponseTime.WithLabelValues("/order").Observe(dbDuration)
-
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				http.Error(w, "Order не найден", http.StatusNotFound)
-				logger.Printf("Order не найден ID: %s", orderID)
-			} else {
-				http.Error(w, "Ошибка в БД", http.StatusInternalServerError)
-				logger.Printf("Ошибка в БД: %s", orderID)
-			}
-
-			overallDuration := time.Since(overallStart).Seconds()
-			my_prometheus.OverallResponseTime.WithLabelValues("/order").Observe(overallDuration)
-			my_prometheus.TotalRequests.WithLabelValues("/order").Inc()
-			return
-		}
-		dbDuration := time.Since(dbStart).Seconds()
-		my_prometheus.DbResponseTime.WithLabelValues("/order").Observe(dbDuration)
-
-		// Добавление заказа в кэш и отправка данных
-		oc.Add(order)
-		json.NewEncoder(w).Encode(order)
-
-		overallDuration := time.Since(overallStart).Seconds()
-		my_prometheus.OverallResponseTime.WithLabelValues("/order").Observe(overallDuration)
-		my_prometheus.TotalRequests.WithLabelValues("/order").Inc()
-	})
+	http.HandleFunc("/order", orderHandler(oc, repo))
 
 	http.HandleFunc("/sendToNats", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
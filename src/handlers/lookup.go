@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/my_prometheus"
+	"wild_project/src/repository"
+)
+
+// RegisterLookupHandler регистрирует обработчик /orders для поиска заказов по вторичным индексам:
+// /orders?track_number=..., customer_id=..., transaction=... или rid=...
+func RegisterLookupHandler(oc cache.Cache, repo repository.OrderRepository) {
+	http.HandleFunc("/orders", lookupHandler(oc, repo))
+}
+
+// lookupHandler возвращает все заказы с заданным значением индекса, сначала из кэша, затем из БД
+func lookupHandler(oc cache.Cache, repo repository.OrderRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		overallStart := time.Now()
+		defer func() {
+			my_prometheus.OverallResponseTime.WithLabelValues("/orders").Observe(time.Since(overallStart).Seconds())
+			my_prometheus.TotalRequests.WithLabelValues("/orders").Inc()
+		}()
+
+		index, value, ok := lookupParams(r.URL.Query())
+		if !ok {
+			http.Error(w, "Нужен один параметр: track_number, customer_id, transaction или rid", http.StatusBadRequest)
+			return
+		}
+
+		cacheStart := time.Now()
+		orders, complete := oc.Find(index, value)
+		my_prometheus.CacheResponseTime.WithLabelValues("/orders").Observe(time.Since(cacheStart).Seconds())
+
+		if !complete {
+			// В кэше могут быть не все заказы, ищем в БД по индексу
+			dbStart := time.Now()
+			var err error
+			orders, err = repo.FindBy(string(index), value)
+			my_prometheus.DbResponseTime.WithLabelValues("/orders").Observe(time.Since(dbStart).Seconds())
+			if err != nil {
+				http.Error(w, "Ошибка в БД", http.StatusInternalServerError)
+				logger.Printf("Ошибка поиска заказов по %s=%s: %v", index, value, err)
+				return
+			}
+			oc.AddFound(index, value, orders)
+		}
+
+		if len(orders) == 0 {
+			http.Error(w, "Заказы не найдены", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(orders)
+	}
+}
+
+// lookupParams извлекает из запроса единственный параметр поиска
+func lookupParams(query url.Values) (cache.Index, string, bool) {
+	var index cache.Index
+	var value string
+	for _, candidate := range cache.Indexes {
+		if v := query.Get(string(candidate)); v != "" {
+			if value != "" {
+				return "", "", false
+			}
+			index, value = candidate, v
+		}
+	}
+	return index, value, value != ""
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wild_project/src/cache"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+func TestLookupHandler(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	for _, uid := range []string{"a", "b", "c"} {
+		order := models.Order{
+			OrderUID:    uid,
+			TrackNumber: "TRACK-" + uid,
+			CustomerID:  "customer",
+			Payment:     models.Payment{Transaction: "tx-" + uid},
+			Items:       []models.Items{{RID: "rid-" + uid}},
+		}
+		assert.NoError(db.Create(&order).Error)
+	}
+
+	oc := cache.NewOrderCache()
+	handler := lookupHandler(oc, repo)
+	lookup := func(query string) (int, []models.Order) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/orders?"+query, nil))
+		var orders []models.Order
+		if rec.Code == http.StatusOK {
+			assert.NoError(json.NewDecoder(rec.Body).Decode(&orders))
+		}
+		return rec.Code, orders
+	}
+
+	code, orders := lookup("customer_id=customer")
+	assert.Equal(http.StatusOK, code)
+	assert.Len(orders, 3)
+	assert.Equal(3, oc.Count(), "найденные в БД заказы добавляются в кэш")
+
+	code, orders = lookup("transaction=tx-b")
+	assert.Equal(http.StatusOK, code)
+	if assert.Len(orders, 1) {
+		assert.Equal("b", orders[0].OrderUID)
+		assert.Equal("rid-b", orders[0].Items[0].RID)
+	}
+
+	// Повторный поиск отвечает из кэша, даже если в БД заказов уже нет
+	db.Where("1 = 1").Delete(&models.Order{})
+	code, orders = lookup("customer_id=customer")
+	assert.Equal(http.StatusOK, code)
+	assert.Len(orders, 3)
+
+	code, _ = lookup("track_number=missing")
+	assert.Equal(http.StatusNotFound, code)
+	code, _ = lookup("track_number=TRACK-a&rid=rid-a")
+	assert.Equal(http.StatusBadRequest, code)
+	code, _ = lookup("")
+	assert.Equal(http.StatusBadRequest, code)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"golang.org/x/sync/singleflight"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/my_prometheus"
+	"wild_project/src/repository"
+)
+
+// orderHandler возвращает заказ по ID: из кэша в готовом JSON, при промахе из БД
+func orderHandler(oc cache.Cache, repo repository.OrderRepository) http.HandlerFunc {
+	var loads singleflight.Group
+	return func(w http.ResponseWriter, r *http.Request) {
+		overallStart := time.Now()
+		defer func() {
+			my_prometheus.OverallResponseTime.WithLabelValues("/order").Observe(time.Since(overallStart).Seconds())
+			my_prometheus.TotalRequests.WithLabelValues("/order").Inc()
+		}()
+
+		// Извлечение ID заказа из запроса
+		orderID := r.URL.Query().Get("id")
+
+		// Заказ в кэше уже сериализован, ответ пишется без обращения к encoding/json
+		cacheStart := time.Now()
+		encoded, exists := oc.GetEncoded(orderID)
+		my_prometheus.CacheResponseTime.WithLabelValues("/order").Observe(time.Since(cacheStart).Seconds())
+		if exists {
+			writeEncoded(w, r, encoded)
+			return
+		}
+
+		// Заказа недавно не было в БД, ответ не требует запроса к ней
+		if oc.Missing(orderID) {
+			my_prometheus.NegativeCacheHits.Inc()
+			http.Error(w, "Order не найден", http.StatusNotFound)
+			return
+		}
+
+		// Если заказ не найден в кэше, идем в базу данных. Одновременные запросы одного заказа
+		// ждут одну загрузку, а не повторяют ее каждый.
+		leader := false
+		value, err, _ := loads.Do(orderID, func() (interface{}, error) {
+			leader = true
+			return loadOrder(oc, repo, orderID)
+		})
+		if !leader {
+			my_prometheus.OrderLoadsCoalesced.Inc()
+		}
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				http.Error(w, "Order не найден", http.StatusNotFound)
+			} else {
+				http.Error(w, "Ошибка в БД", http.StatusInternalServerError)
+			}
+			return
+		}
+		writeEncoded(w, r, value.(cache.Encoded))
+	}
+}
+
+// loadOrder загружает заказ из БД, добавляет его в кэш и сериализует.
+// Если заказа нет, отмечает его отсутствие, чтобы следующие запросы не шли в БД.
+func loadOrder(oc cache.Cache, repo repository.OrderRepository, orderID string) (cache.Encoded, error) {
+	dbStart := time.Now()
+	order, err := repo.GetByUID(orderID)
+	my_prometheus.DbResponseTime.WithLabelValues("/order").Observe(time.Since(dbStart).Seconds())
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			oc.MarkMissing(orderID)
+			my_prometheus.NegativeCacheMarks.Inc()
+			logger.Printf("Order не найден ID: %s", orderID)
+		} else {
+			logger.Printf("Ошибка в БД: %s", orderID)
+		}
+		return cache.Encoded{}, err
+	}
+
+	// Добавление заказа в кэш и отправка данных
+	oc.Add(order)
+	encoded, err := cache.Encode(order, false)
+	if err != nil {
+		logger.Printf("Ошибка сериализации заказа %s: %v", orderID, err)
+	}
+	return encoded, err
+}
+
+// writeEncoded пишет сериализованный заказ с ETag и Content-Length. Если у клиента уже есть
+// эта версия заказа, отвечает 304, если клиент принимает gzip и есть сжатый вариант - отдает его.
+func writeEncoded(w http.ResponseWriter, r *http.Request, encoded cache.Encoded) {
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("ETag", encoded.ETag)
+	header.Set("Vary", "Accept-Encoding")
+	if etagMatches(r.Header.Get("If-None-Match"), encoded.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body := encoded.JSON
+	if encoded.Gzip != nil && acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		header.Set("Content-Encoding", "gzip")
+		body = encoded.Gzip
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(body); err != nil {
+		logger.Printf("Ошибка записи ответа: %v", err)
+	}
+}
+
+// etagMatches проверяет, есть ли etag в списке заголовка If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		// Для If-None-Match используется слабое сравнение, префикс W/ не учитывается
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip проверяет, принимает ли клиент ответ в gzip, с учетом q=0
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+func TestOrderHandler(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	order := models.Order{
+		OrderUID:    "a",
+		TrackNumber: "TRACK-a",
+		Payment:     models.Payment{Transaction: "tx-a"},
+		Items:       []models.Items{{RID: "rid-a"}, {RID: "rid-b"}},
+	}
+	assert.NoError(db.Create(&order).Error)
+
+	oc, err := cache.NewBoundedOrderCache(cache.Config{Policy: cache.PolicyLRU, Gzip: true})
+	assert.NoError(err)
+	handler := orderHandler(oc, repo)
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/order?id=a", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	// Промах читает заказ из БД и добавляет его в кэш
+	miss := get(nil)
+	assert.Equal(http.StatusOK, miss.Code)
+	assert.Equal(1, oc.Count())
+	etag := miss.Header().Get("ETag")
+	assert.NotEmpty(etag)
+
+	// Попадание отдает те же байты, что json.Encoder, с тем же ETag
+	hit := get(nil)
+	assert.Equal(http.StatusOK, hit.Code)
+	assert.Equal(etag, hit.Header().Get("ETag"))
+	assert.Equal(miss.Body.String(), hit.Body.String())
+	assert.Equal(fmt.Sprint(hit.Body.Len()), hit.Header().Get("Content-Length"))
+	var expected bytes.Buffer
+	cached, _ := oc.Get("a")
+	assert.NoError(json.NewEncoder(&expected).Encode(cached))
+	assert.Equal(expected.String(), hit.Body.String())
+
+	// Клиент с gzip получает сжатый вариант
+	zipped := get(map[string]string{"Accept-Encoding": "br, gzip"})
+	assert.Equal("gzip", zipped.Header().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(zipped.Body)
+	if assert.NoError(err) {
+		body, err := io.ReadAll(zr)
+		assert.NoError(err)
+		assert.Equal(expected.String(), string(body))
+	}
+	assert.Empty(get(map[string]string{"Accept-Encoding": "gzip;q=0"}).Header().Get("Content-Encoding"))
+
+	// Совпавший ETag дает 304 без тела
+	notModified := get(map[string]string{"If-None-Match": `"other", ` + etag})
+	assert.Equal(http.StatusNotModified, notModified.Code)
+	assert.Zero(notModified.Body.Len())
+
+	// После изменения заказа ETag меняется
+	cached.TrackNumber = "UPDATED"
+	oc.Update(cached)
+	changed := get(map[string]string{"If-None-Match": etag})
+	assert.Equal(http.StatusOK, changed.Code)
+	assert.NotEqual(etag, changed.Header().Get("ETag"))
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/order?id=missing", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+// benchmarkOrder заказ с типичным количеством позиций
+func benchmarkOrder() models.Order {
+	order := models.Order{OrderUID: "bench", TrackNumber: "WBILMTESTTRACK", CustomerID: "test"}
+	for i := 0; i < 10; i++ {
+		order.Items = append(order.Items, models.Items{ChrtID: i, RID: fmt.Sprintf("rid-%d", i), Name: "Mascaras", Brand: "Vivienne Sabo"})
+	}
+	return order
+}
+
+// BenchmarkOrderHitEncode прежний путь попадания: заказ копируется из кэша и сериализуется на каждый запрос
+func BenchmarkOrderHitEncode(b *testing.B) {
+	oc := cache.NewOrderCache()
+	oc.Add(benchmarkOrder())
+	req := httptest.NewRequest(http.MethodGet, "/order?id=bench", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		order, _ := oc.Get(req.URL.Query().Get("id"))
+		json.NewEncoder(rec).Encode(order)
+	}
+}
+
+// BenchmarkOrderHitPreEncoded попадание с готовым JSON из кэша
+func BenchmarkOrderHitPreEncoded(b *testing.B) {
+	oc := cache.NewOrderCache()
+	oc.Add(benchmarkOrder())
+	handler := orderHandler(oc, nil)
+	req := httptest.NewRequest(http.MethodGet, "/order?id=bench", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler(httptest.NewRecorder(), req)
+	}
+}
+
+func TestOrderHandlerNegativeCache(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	oc, err := cache.NewBoundedOrderCache(cache.Config{Policy: cache.PolicyLRU, MissingTTL: time.Minute})
+	assert.NoError(err)
+	handler := orderHandler(oc, repo)
+	get := func() int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/order?id=late", nil))
+		return rec.Code
+	}
+
+	assert.Equal(http.StatusNotFound, get())
+	assert.True(oc.Missing("late"))
+
+	// Пока отметка действует, заказ, записанный в БД в обход приема сообщений, не виден
+	order := models.Order{OrderUID: "late"}
+	assert.NoError(db.Create(&order).Error)
+	assert.Equal(http.StatusNotFound, get())
+
+	// Добавление заказа при приеме снимает отметку
+	oc.Add(order)
+	assert.False(oc.Missing("late"))
+	assert.Equal(http.StatusOK, get())
+}
+
+// ingestDuringLookup добавляет заказ в кэш, пока идет запрос к БД, как параллельный прием сообщения
+type ingestDuringLookup struct {
+	repository.OrderRepository
+	oc    cache.Cache
+	order models.Order
+}
+
+func (r ingestDuringLookup) GetByUID(orderUID string) (models.Order, error) {
+	order, err := r.OrderRepository.GetByUID(orderUID)
+	r.oc.Add(r.order)
+	return order, err
+}
+
+// Отметка после ErrNotFound не скрывает заказ, который добавили в кэш во время запроса к БД
+func TestOrderHandlerNegativeCacheIngestRace(t *testing.T) {
+	assert := assert.New(t)
+	oc, err := cache.NewBoundedOrderCache(cache.Config{Policy: cache.PolicyLRU, MissingTTL: time.Minute})
+	assert.NoError(err)
+	repo := ingestDuringLookup{OrderRepository: repository.NewMemoryRepository(), oc: oc, order: models.Order{OrderUID: "late"}}
+	handler := orderHandler(oc, repo)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/order?id=late", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+	assert.False(oc.Missing("late"))
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/order?id=late", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+}
+
+func TestOrderHandlerCoalescesMisses(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	order := models.Order{OrderUID: "a", Items: []models.Items{{RID: "rid-a"}}}
+	assert.NoError(db.Create(&order).Error)
+
+	// Первый запрос к БД ждет, пока остальные запросы не присоединятся к загрузке
+	var queries int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	assert.NoError(db.Callback().Query().Before("gorm:query").Register("test:block", func(*gorm.DB) {
+		if atomic.AddInt32(&queries, 1) == 1 {
+			close(entered)
+			<-release
+		}
+	}))
+
+	handler := orderHandler(cache.NewOrderCache(), repo)
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/order?id=a", nil))
+			codes[i] = rec.Code
+		}(i)
+	}
+	<-entered
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, code := range codes {
+		assert.Equal(http.StatusOK, code)
+	}
+	// Заказ и его доставка, оплата и позиции читаются одной загрузкой на все запросы
+	assert.Equal(int32(4), atomic.LoadInt32(&queries))
+}
+
+func TestOrderHandlerRepositoryError(t *testing.T) {
+	assert := assert.New(t)
+	repo := repository.NewMemoryRepository()
+	repo.Err = errors.New("connection refused")
+	oc, err := cache.NewBoundedOrderCache(cache.Config{Policy: cache.PolicyLRU, MissingTTL: time.Minute})
+	assert.NoError(err)
+
+	rec := httptest.NewRecorder()
+	orderHandler(oc, repo)(rec, httptest.NewRequest(http.MethodGet, "/order?id=a", nil))
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+	assert.False(oc.Missing("a"), "сбой БД не означает, что заказа нет")
+}
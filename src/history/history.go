@@ -0,0 +1,155 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"gorm.io/gorm"
+	"log"
+	"time"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+)
+
+var logger *log.Logger
+var filePath = "logs/history.log"
+
+func init() {
+	logger = log.New(&lumberjack.Logger{
+		Filename:   filePath,
+		MaxSize:    10, // Размер файла в мегабайтах до ротации
+		MaxBackups: 3,  // Максимальное количество старых файлов логов
+		MaxAge:     28, // Максимальное количество дней для хранения логов
+		Compress:   true,
+	}, "HISTORY: ", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// Виды изменений заказа в истории
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+)
+
+// NATSSource источник изменения из сообщения канала с номером sequence
+func NATSSource(sequence uint64) string {
+	return fmt.Sprintf("nats:%d", sequence)
+}
+
+// HTTPSource источник изменения из HTTP запроса с идентификатором requestID
+func HTTPSource(requestID string) string {
+	return "http:" + requestID
+}
+
+// Store журнал изменений заказов в таблице order_history
+type Store struct {
+	db *gorm.DB
+}
+
+// NewStore создает журнал поверх подключения db
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// encode сериализует заказ для журнала, nil - заказа нет
+func encode(order *models.Order) (*string, error) {
+	if order == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, err
+	}
+	document := string(data)
+	return &document, nil
+}
+
+// Record добавляет запись об изменении заказа orderUID из previous в current через транзакцию
+// изменения tx: если запись не удалась, изменение откатывается
+func (s *Store) Record(tx *gorm.DB, orderUID string, source string, previous, current *models.Order) error {
+	entry := models.OrderHistory{OrderUID: orderUID, Source: source}
+	var err error
+	if entry.Previous, err = encode(previous); err != nil {
+		return err
+	}
+	if entry.Current, err = encode(current); err != nil {
+		return err
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		logger.Printf("Изменение заказа %s из %q не записано в историю: %v", orderUID, source, err)
+		return err
+	}
+	return nil
+}
+
+// Wrap возвращает хранилище, которое записывает каждое изменение заказа через inner в store
+// в транзакции самого изменения. Прежнее состояние заказа читается под блокировкой его строки,
+// поэтому параллельные изменения записываются в историю в порядке применения.
+func Wrap(inner repository.OrderRepository, store *Store) (repository.OrderRepository, error) {
+	return repository.WithJournal(inner, store)
+}
+
+var _ repository.Journal = (*Store)(nil)
+
+// List возвращает записи истории заказа в порядке добавления
+func (s *Store) List(orderUID string) ([]models.OrderHistory, error) {
+	var entries []models.OrderHistory
+	err := s.db.Where("order_uid = ?", orderUID).Order("id").Find(&entries).Error
+	return entries, err
+}
+
+// Event изменение заказа в истории. Для обновления приводится список измененных полей,
+// для создания и удаления - сам заказ.
+type Event struct {
+	ID      uint            `json:"id"`
+	At      time.Time       `json:"at"`
+	Source  string          `json:"source"`
+	Action  string          `json:"action"`
+	Changes []models.Change `json:"changes,omitempty"`
+	Order   *models.Order   `json:"order,omitempty"`
+}
+
+// decode восстанавливает заказ из документа журнала
+func decode(document *string) (*models.Order, error) {
+	if document == nil {
+		return nil, nil
+	}
+	var order models.Order
+	if err := json.Unmarshal([]byte(*document), &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// Timeline возвращает историю заказа с изменениями полей в порядке добавления
+func (s *Store) Timeline(orderUID string) ([]Event, error) {
+	entries, err := s.List(orderUID)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		previous, err := decode(entry.Previous)
+		if err != nil {
+			return nil, fmt.Errorf("запись истории %d: %w", entry.ID, err)
+		}
+		current, err := decode(entry.Current)
+		if err != nil {
+			return nil, fmt.Errorf("запись истории %d: %w", entry.ID, err)
+		}
+		event := Event{ID: entry.ID, At: entry.CreatedAt, Source: entry.Source}
+		switch {
+		case previous == nil:
+			event.Action = ActionCreated
+			event.Order = current
+		case current == nil:
+			event.Action = ActionDeleted
+			event.Order = previous
+		default:
+			event.Action = ActionUpdated
+			event.Changes = models.Diff(*previous, *current)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,137 @@
+package history
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+func TestRepositoryRecordsChanges(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	store := NewStore(db)
+	repo, err := Wrap(repository.NewGormRepository(db), store)
+	require.NoError(t, err)
+
+	order := models.Order{OrderUID: "a", Version: 1, TrackNumber: "T1", Items: []models.Items{{ChrtID: 1}}}
+	assert.NoError(repository.WithSource(repo, NATSSource(1)).Create(&order))
+
+	next := models.Order{OrderUID: "a", Version: 2, TrackNumber: "T2", Items: []models.Items{{ChrtID: 1}}}
+	assert.NoError(repository.WithSource(repo, NATSSource(2)).Upsert(&next))
+	current, err := repo.GetByUID("a")
+	require.NoError(t, err)
+	assert.NoError(repository.WithSource(repo, NATSSource(3)).SetItemStatus(current, 3, 1, 5))
+	current, _ = repo.GetByUID("a")
+	cancelledAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(repository.WithSource(repo, NATSSource(4)).Cancel(current, 4, cancelledAt))
+	// Неудачное изменение не записывается
+	assert.ErrorIs(repo.Cancel(current, 4, time.Now()), repository.ErrConcurrentUpdate)
+	assert.NoError(repository.WithSource(repo, HTTPSource("req-1")).Delete("a"))
+
+	events, err := store.Timeline("a")
+	assert.NoError(err)
+	if !assert.Len(events, 5) {
+		return
+	}
+	var sources, actions []string
+	for _, event := range events {
+		sources = append(sources, event.Source)
+		actions = append(actions, event.Action)
+	}
+	assert.Equal([]string{"nats:1", "nats:2", "nats:3", "nats:4", "http:req-1"}, sources)
+	assert.Equal([]string{ActionCreated, ActionUpdated, ActionUpdated, ActionUpdated, ActionDeleted}, actions)
+	assert.Equal("T1", events[0].Order.TrackNumber)
+	// В изменениях нет служебных полей записей, хотя замена заказа пересоздает позиции
+	assert.Equal([]models.Change{
+		{Path: "TrackNumber", Old: "T1", New: "T2"},
+		{Path: "Version", Old: 1, New: 2},
+	}, events[1].Changes)
+	assert.Equal([]models.Change{
+		{Path: "items[0].Status", Old: 0, New: 5},
+		{Path: "Version", Old: 2, New: 3},
+	}, events[2].Changes)
+	assert.Equal([]models.Change{
+		{Path: "Version", Old: 3, New: 4},
+		{Path: "CancelledAt", Old: (*time.Time)(nil), New: &cancelledAt},
+	}, events[3].Changes)
+	assert.NotNil(events[4].Order.CancelledAt)
+}
+
+func TestRepositoryRecordsBatchSources(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	store := NewStore(db)
+	repo, err := Wrap(repository.NewGormRepository(db), store)
+	require.NoError(t, err)
+
+	orders := []models.Order{{OrderUID: "a"}, {OrderUID: "b"}}
+	sources := map[string]string{"a": NATSSource(10), "b": NATSSource(11)}
+	assert.NoError(repository.WithSources(repo, sources).CreateBatch(orders))
+
+	for uid, source := range sources {
+		events, err := store.Timeline(uid)
+		assert.NoError(err)
+		if assert.Len(events, 1) {
+			assert.Equal(source, events[0].Source)
+			assert.Equal(ActionCreated, events[0].Action)
+		}
+	}
+	events, err := store.Timeline("missing")
+	assert.NoError(err)
+	assert.Empty(events)
+}
+
+// failingJournal журнал, запись в который всегда завершается ошибкой
+type failingJournal struct{}
+
+func (failingJournal) Record(*gorm.DB, string, string, *models.Order, *models.Order) error {
+	return errors.New("disk full")
+}
+
+func TestFailedRecordRollsBackChange(t *testing.T) {
+	db := testdb.Open(t)
+	for name, inner := range map[string]repository.OrderRepository{
+		"relational": repository.NewGormRepository(db),
+		"document":   repository.NewDocumentRepository(db),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			order := models.Order{OrderUID: name, Version: 1}
+			require.NoError(t, inner.Create(&order))
+			repo, err := repository.WithJournal(inner, failingJournal{})
+			require.NoError(t, err)
+
+			created := models.Order{OrderUID: name + "-new"}
+			assert.ErrorIs(repo.Create(&created), repository.ErrJournal)
+			_, err = inner.GetByUID(name + "-new")
+			assert.ErrorIs(err, repository.ErrNotFound)
+
+			assert.ErrorIs(repo.CreateBatch([]models.Order{{OrderUID: name + "-batch"}}), repository.ErrJournal)
+			_, err = inner.GetByUID(name + "-batch")
+			assert.ErrorIs(err, repository.ErrNotFound)
+
+			next := models.Order{OrderUID: name, Version: 2, TrackNumber: "T2"}
+			assert.ErrorIs(repo.Upsert(&next), repository.ErrJournal)
+			assert.ErrorIs(repo.Cancel(order, 2, time.Now()), repository.ErrJournal)
+			assert.ErrorIs(repo.Delete(name), repository.ErrJournal)
+
+			// Заказ остался в состоянии до неудачных изменений
+			stored, err := inner.GetByUID(name)
+			assert.NoError(err)
+			assert.Equal(1, stored.Version)
+			assert.Empty(stored.TrackNumber)
+			assert.Nil(stored.CancelledAt)
+		})
+	}
+}
+
+func TestWrapRequiresTransactions(t *testing.T) {
+	_, err := Wrap(repository.NewMemoryRepository(), NewStore(testdb.Open(t)))
+	assert.Error(t, err)
+}
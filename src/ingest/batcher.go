@@ -0,0 +1,243 @@
+package ingest
+
+import (
+	"sync"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/history"
+	"wild_project/src/models"
+	"wild_project/src/my_prometheus"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
+	"wild_project/src/utils"
+)
+
+// pendingOrder заказ, ожидающий записи в составе пачки, и сообщение, которое нужно подтвердить после записи
+type pendingOrder struct {
+	order models.Order
+	msg   *natsclient.Message
+}
+
+// Batcher накапливает заказы и записывает их в БД пачками по размеру или по времени.
+// Сообщения подтверждаются, а кэш обновляется только после фиксации транзакции с пачкой.
+type Batcher struct {
+	orderCache cache.Cache
+	repo       repository.OrderRepository
+	fallback   natsclient.Handler // Обработчик одиночных сообщений для некорректных заказов и неудачных пачек
+	size       int
+	mu         sync.Mutex
+	batch      []pendingOrder
+	created    []models.Order // Заказы, записанные под мьютексом, о которых еще не сообщили кэшу
+	closed     bool
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// NewBatcher создает Batcher, который сбрасывает пачку при достижении size заказов или раз в interval.
+// Подписка должна использовать AsyncAck и MaxInflight не меньше size.
+func NewBatcher(orderCache cache.Cache, repo repository.OrderRepository, fallback natsclient.Handler, size int, interval time.Duration) *Batcher {
+	if size < 1 {
+		size = 1
+	}
+	b := &Batcher{
+		orderCache: orderCache,
+		repo:       repo,
+		fallback:   fallback,
+		size:       size,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go b.flushPeriodically(interval)
+	return b
+}
+
+// Submit добавляет заказ из сообщения с событием created в текущую пачку
+func (b *Batcher) Submit(m *natsclient.Message) error {
+	event, err := utils.DecodeEvent(m.Data)
+	if err == nil {
+		err = utils.ValidateEvent(&event)
+	}
+	if err != nil || event.Type != models.EventCreated {
+		// Некорректные сообщения обрабатываются по одному, чтобы попасть в карантин,
+		// события изменения применяются по одному с проверкой версии
+		if err == nil {
+			b.flushPending(event.OrderUID)
+		}
+		b.handleSingle(m)
+		return nil
+	}
+	order := *event.Order
+
+	b.mu.Lock()
+	defer b.unlock()
+	if b.closed {
+		return ErrPoolClosed
+	}
+
+	b.batch = append(b.batch, pendingOrder{order: order, msg: m})
+	if len(b.batch) >= b.size {
+		b.flush()
+	}
+	return nil
+}
+
+// unlock отпускает мьютекс и сообщает кэшу о заказах, созданных пачками под ним. Событие для остальных
+// реплик публикуется одно на все заказы и уже без мьютекса, чтобы не задерживать прием сообщений.
+func (b *Batcher) unlock() {
+	created := b.created
+	b.created = nil
+	b.mu.Unlock()
+	if len(created) > 0 {
+		b.orderCache.Created(created)
+	}
+}
+
+// flushPending записывает текущую пачку, если в ней ждет создание заказа orderUID,
+// чтобы событие изменения заказа применялось после его создания, а не падало с ErrOrderNotFound
+func (b *Batcher) flushPending(orderUID string) {
+	b.mu.Lock()
+	defer b.unlock()
+	for _, p := range b.batch {
+		if p.order.OrderUID == orderUID {
+			b.flush()
+			return
+		}
+	}
+}
+
+// flushPeriodically сбрасывает неполную пачку по таймеру
+func (b *Batcher) flushPeriodically(interval time.Duration) {
+	defer close(b.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.mu.Lock()
+			b.flush()
+			b.unlock()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// flush записывает накопленную пачку одной транзакцией, вызывается под мьютексом
+func (b *Batcher) flush() {
+	if len(b.batch) == 0 {
+		return
+	}
+	batch := b.batch
+	b.batch = nil
+
+	start := time.Now()
+	defer func() {
+		my_prometheus.IngestProcessingTime.Observe(time.Since(start).Seconds())
+	}()
+	my_prometheus.IngestBatchSize.Observe(float64(len(batch)))
+
+	// Отбрасываем заказы, которые уже есть в кэше или повторяются внутри пачки
+	uids := make([]string, 0, len(batch))
+	seen := make(map[string]bool, len(batch))
+	var duplicates []*natsclient.Message
+	var fresh []pendingOrder
+	for _, p := range batch {
+		if _, exists := b.orderCache.Get(p.order.OrderUID); exists || seen[p.order.OrderUID] {
+			duplicates = append(duplicates, p.msg)
+			continue
+		}
+		seen[p.order.OrderUID] = true
+		uids = append(uids, p.order.OrderUID)
+		fresh = append(fresh, p)
+	}
+
+	// Заказы, которые уже есть в БД, только добавляются в кэш
+	stored, err := b.repo.GetByUIDs(uids)
+	if err != nil {
+		logger.Printf("Ошибка при запросе к БД: %v", err)
+		b.fallbackAll(batch)
+		return
+	}
+	existing := make(map[string]bool, len(stored))
+	for _, order := range stored {
+		existing[order.OrderUID] = true
+		b.orderCache.Add(order)
+	}
+
+	orders := make([]models.Order, 0, len(fresh))
+	var inserted []pendingOrder
+	for _, p := range fresh {
+		if existing[p.order.OrderUID] {
+			duplicates = append(duplicates, p.msg)
+			continue
+		}
+		orders = append(orders, p.order)
+		inserted = append(inserted, p)
+	}
+
+	if len(orders) > 0 {
+		// Создание каждого заказа в истории приписывается его сообщению
+		sources := make(map[string]string, len(inserted))
+		for _, p := range inserted {
+			sources[p.order.OrderUID] = history.NATSSource(p.msg.Sequence)
+		}
+		if err := repository.WithSources(b.repo, sources).CreateBatch(orders); err != nil {
+			// Пачка откатилась целиком, обрабатываем сообщения по одному, чтобы найти проблемный заказ
+			logger.Printf("Ошибка при сохранении пачки из %d заказов: %v", len(orders), err)
+			b.fallbackAll(inserted)
+			orders = nil
+			inserted = nil
+		}
+	}
+
+	for i, order := range orders {
+		b.orderCache.Add(order)
+		b.orderCache.MarkApplied(inserted[i].msg.Sequence)
+		ack(inserted[i].msg)
+	}
+	b.created = append(b.created, orders...)
+	for _, m := range duplicates {
+		b.orderCache.MarkApplied(m.Sequence)
+		ack(m)
+	}
+	logger.Printf("Пачка записана: %d новых заказов, %d дубликатов", len(orders), len(duplicates))
+}
+
+// fallbackAll обрабатывает сообщения пачки по одному
+func (b *Batcher) fallbackAll(batch []pendingOrder) {
+	for _, p := range batch {
+		b.handleSingle(p.msg)
+	}
+}
+
+// handleSingle обрабатывает одно сообщение обработчиком fallback и подтверждает его при успехе
+func (b *Batcher) handleSingle(m *natsclient.Message) {
+	if err := b.fallback(m); err != nil {
+		logger.Printf("Сообщение %d не обработано: %v", m.Sequence, err)
+		return
+	}
+	ack(m)
+}
+
+// ack подтверждает сообщение и логирует ошибку подтверждения
+func ack(m *natsclient.Message) {
+	if err := m.Ack(); err != nil {
+		logger.Printf("Ошибка подтверждения сообщения %d: %v", m.Sequence, err)
+	}
+}
+
+// Close записывает оставшуюся пачку и останавливает таймер
+func (b *Batcher) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.unlock()
+		return
+	}
+	b.closed = true
+	b.flush()
+	b.unlock()
+
+	close(b.stop)
+	<-b.done
+}
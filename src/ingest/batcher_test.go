@@ -0,0 +1,130 @@
+package ingest
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/deadletter"
+	"wild_project/src/models"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
+	"wild_project/src/tests"
+	"wild_project/src/tests/testdb"
+	"wild_project/src/utils"
+)
+
+func TestBatcherWritesBatches(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+
+	orderCache := cache.NewOrderCache()
+	dlq := deadletter.NewQueue(db, broker, "orders-dlq", 5)
+	batcher := NewBatcher(orderCache, repo, utils.NewOrderHandler(orderCache, repo, dlq), 4, 50*time.Millisecond)
+	defer batcher.Close()
+
+	err := broker.Subscribe("orders", batcher.Submit,
+		natsclient.AsyncAck(),
+		natsclient.MaxInflight(8),
+		natsclient.AckWait(time.Second),
+	)
+	assert.NoError(err)
+
+	messages, err := tests.GenerateTestMessages(10)
+	assert.NoError(err)
+	for _, message := range messages {
+		assert.NoError(broker.PublishMessage("orders", []byte(message)))
+	}
+	// Повтор внутри потока и некорректное сообщение
+	assert.NoError(broker.PublishMessage("orders", []byte(messages[3])))
+	assert.NoError(broker.PublishMessage("orders", []byte("not a json")))
+
+	assert.Eventually(func() bool {
+		var quarantined int64
+		db.Model(&models.QuarantinedMessage{}).Count(&quarantined)
+		return orderCache.Count() == 10 && quarantined == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var stored int64
+	db.Model(&models.Order{}).Count(&stored)
+	assert.Equal(int64(10), stored)
+
+	var items int64
+	db.Model(&models.Items{}).Count(&items)
+	assert.Equal(int64(10), items, "связанные записи сохраняются вместе с пачкой")
+}
+
+func TestBatcherFlushesBeforeEventOfPendingOrder(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	orderCache := cache.NewOrderCache()
+	dlq := deadletter.NewQueue(db, natsclient.NewMemoryBroker(), "orders-dlq", 5)
+	// Пачка не заполнится и не сбросится по таймеру до конца теста
+	batcher := NewBatcher(orderCache, repo, utils.NewOrderHandler(orderCache, repo, dlq), 100, time.Hour)
+	defer batcher.Close()
+
+	messages, err := tests.GenerateTestMessages(2)
+	assert.NoError(err)
+	for i, message := range messages {
+		assert.NoError(batcher.Submit(&natsclient.Message{Data: []byte(message), Sequence: uint64(i + 1)}))
+	}
+	order, err := utils.DeserializeOrder(messages[0])
+	assert.NoError(err)
+	cancel := fmt.Sprintf(`{"Type": "cancelled", "OrderUID": %q, "Version": 2}`, order.OrderUID)
+	assert.NoError(batcher.Submit(&natsclient.Message{Data: []byte(cancel), Sequence: 3}))
+
+	// Событие применилось к заказу из пачки, вся пачка записана до него
+	stored, err := repo.GetByUID(order.OrderUID)
+	assert.NoError(err)
+	assert.Equal(2, stored.Version)
+	assert.NotNil(stored.CancelledAt)
+	var count int64
+	db.Model(&models.Order{}).Count(&count)
+	assert.Equal(int64(2), count)
+	var quarantined int64
+	db.Model(&models.QuarantinedMessage{}).Count(&quarantined)
+	assert.Zero(quarantined)
+}
+
+// createdRecorder кэш, который запоминает вызовы Created и проверяет, что мьютекс пачки уже отпущен
+type createdRecorder struct {
+	*cache.OrderCache
+	batcher *Batcher
+	calls   []int
+	locked  bool
+}
+
+func (c *createdRecorder) Created(orders []models.Order) {
+	if c.batcher.mu.TryLock() {
+		c.batcher.mu.Unlock()
+	} else {
+		c.locked = true
+	}
+	c.calls = append(c.calls, len(orders))
+}
+
+func TestBatcherReportsCreatedOrdersOncePerBatch(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	orderCache := &createdRecorder{OrderCache: cache.NewOrderCache()}
+	dlq := deadletter.NewQueue(db, natsclient.NewMemoryBroker(), "orders-dlq", 5)
+	batcher := NewBatcher(orderCache, repo, utils.NewOrderHandler(orderCache, repo, dlq), 5, time.Hour)
+	orderCache.batcher = batcher
+	defer batcher.Close()
+
+	messages, err := tests.GenerateTestMessages(5)
+	assert.NoError(err)
+	for i, message := range messages {
+		assert.NoError(batcher.Submit(&natsclient.Message{Data: []byte(message), Sequence: uint64(i + 1)}))
+	}
+
+	assert.Equal([]int{5}, orderCache.calls)
+	assert.False(orderCache.locked, "о заказах сообщается после того, как мьютекс пачки отпущен")
+	assert.Equal(5, orderCache.Count())
+}
@@ -0,0 +1,126 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+	"wild_project/src/my_prometheus"
+	natsclient "wild_project/src/nats"
+)
+
+var logger *log.Logger
+var filePath = "logs/ingest.log"
+
+func init() {
+	logger = log.New(&lumberjack.Logger{
+		Filename:   filePath,
+		MaxSize:    10, // Размер файла в мегабайтах до ротации
+		MaxBackups: 3,  // Максимальное количество старых файлов логов
+		MaxAge:     28, // Максимальное количество дней для хранения логов
+		Compress:   true,
+	}, "INGEST: ", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// ErrPoolClosed возвращается при попытке отправить сообщение в остановленный пул
+var ErrPoolClosed = errors.New("пул обработчиков остановлен")
+
+// Pool распределяет сообщения между обработчиками по OrderUID.
+// Сообщения одного заказа попадают к одному обработчику и обрабатываются по порядку.
+type Pool struct {
+	handler natsclient.Handler
+	queues  []chan *natsclient.Message
+	mu      sync.RWMutex
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewPool запускает workers обработчиков, у каждого очередь на queueSize сообщений.
+// Подписка должна использовать AsyncAck: сообщение подтверждается после успешной обработки в пуле.
+func NewPool(workers int, queueSize int, handler natsclient.Handler) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &Pool{
+		handler: handler,
+		queues:  make([]chan *natsclient.Message, workers),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *natsclient.Message, queueSize)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// Submit ставит сообщение в очередь обработчика, отвечающего за его OrderUID.
+// Если очередь заполнена, вызов блокируется, и брокер перестает доставлять новые сообщения.
+func (p *Pool) Submit(m *natsclient.Message) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	my_prometheus.IngestQueueDepth.Inc()
+	p.queues[p.queueIndex(m)] <- m
+	return nil
+}
+
+// queueIndex выбирает очередь по хешу OrderUID, некорректные сообщения всегда попадают в первую очередь.
+// Как и в utils.DecodeEvent, OrderUID события без верхнего поля OrderUID берется из его заказа.
+func (p *Pool) queueIndex(m *natsclient.Message) int {
+	var key struct {
+		OrderUID string `json:"OrderUID"`
+		Order    *struct {
+			OrderUID string `json:"OrderUID"`
+		} `json:"Order"`
+	}
+	if err := json.Unmarshal(m.Data, &key); err != nil {
+		return 0
+	}
+	if key.Order != nil && key.OrderUID == "" {
+		key.OrderUID = key.Order.OrderUID
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key.OrderUID))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// work обрабатывает сообщения из очереди и подтверждает успешно обработанные
+func (p *Pool) work(queue chan *natsclient.Message) {
+	defer p.wg.Done()
+
+	for m := range queue {
+		my_prometheus.IngestQueueDepth.Dec()
+		start := time.Now()
+		err := p.handler(m)
+		my_prometheus.IngestProcessingTime.Observe(time.Since(start).Seconds())
+
+		if err != nil {
+			// Сообщение не подтверждается и будет доставлено повторно после AckWait
+			logger.Printf("Сообщение %d не обработано: %v", m.Sequence, err)
+			continue
+		}
+		ack(m)
+	}
+}
+
+// Close перестает принимать сообщения и ждет, пока обработчики разберут очереди
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
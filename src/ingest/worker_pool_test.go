@@ -0,0 +1,97 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+	natsclient "wild_project/src/nats"
+)
+
+func TestPoolKeepsPerOrderOrdering(t *testing.T) {
+	assert := assert.New(t)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+
+	var mu sync.Mutex
+	seen := make(map[string][]uint64)
+	failed := make(map[uint64]bool)
+	done := make(chan struct{}, 100)
+
+	pool := NewPool(4, 8, func(m *natsclient.Message) error {
+		key, err := orderUID(m)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// Одно сообщение падает при первой доставке и должно прийти повторно
+		if m.Sequence == 7 && !failed[m.Sequence] {
+			failed[m.Sequence] = true
+			return errors.New("временная ошибка")
+		}
+		seen[key] = append(seen[key], m.Sequence)
+		done <- struct{}{}
+		return nil
+	})
+	defer pool.Close()
+
+	err := broker.Subscribe("orders", pool.Submit,
+		natsclient.AsyncAck(),
+		natsclient.MaxInflight(8),
+		natsclient.AckWait(20*time.Millisecond),
+	)
+	assert.NoError(err)
+
+	for i := 0; i < 30; i++ {
+		msg := fmt.Sprintf(`{"OrderUID": "order-%d", "TrackNumber": "%d"}`, i%3, i)
+		assert.NoError(broker.PublishMessage("orders", []byte(msg)))
+	}
+
+	for i := 0; i < 30; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Обработано только %d сообщений", i)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(seen, 3)
+	for key, seqs := range seen {
+		assert.Len(seqs, 10, key)
+		if key != "order-0" {
+			// Сообщения без повторной доставки обрабатываются строго по порядку
+			assert.IsIncreasing(seqs, key)
+		}
+	}
+}
+
+// orderUID извлекает OrderUID для проверки в тесте
+func orderUID(m *natsclient.Message) (string, error) {
+	var key struct{ OrderUID string }
+	err := json.Unmarshal(m.Data, &key)
+	return key.OrderUID, err
+}
+
+func TestPoolQueueIndexUsesNestedOrderUID(t *testing.T) {
+	assert := assert.New(t)
+	pool := NewPool(8, 1, func(m *natsclient.Message) error { return nil })
+	defer pool.Close()
+
+	queues := make(map[int]bool)
+	for i := 0; i < 20; i++ {
+		uid := fmt.Sprintf("order-%d", i)
+		nested := fmt.Sprintf(`{"Type": "updated", "Version": 2, "Order": {"OrderUID": "%s"}}`, uid)
+		top := fmt.Sprintf(`{"Type": "cancelled", "OrderUID": "%s", "Version": 3}`, uid)
+		index := pool.queueIndex(&natsclient.Message{Data: []byte(nested)})
+		// События одного заказа попадают в одну очередь независимо от того, где указан OrderUID
+		assert.Equal(pool.queueIndex(&natsclient.Message{Data: []byte(top)}), index, uid)
+		queues[index] = true
+	}
+	assert.Greater(len(queues), 1, "события разных заказов распределяются по очередям")
+}
@@ -0,0 +1,151 @@
+package invalidation
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nuid"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"log"
+	"wild_project/src/cache"
+	"wild_project/src/models"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
+)
+
+var logger *log.Logger
+var filePath = "logs/invalidation.log"
+
+func init() {
+	logger = log.New(&lumberjack.Logger{
+		Filename:   filePath,
+		MaxSize:    10, // Размер файла в мегабайтах до ротации
+		MaxBackups: 3,  // Максимальное количество старых файлов логов
+		MaxAge:     28, // Максимальное количество дней для хранения логов
+		Compress:   true,
+	}, "INVALIDATION: ", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// Типы событий кэша
+const (
+	EventRefresh    = "refresh"    // Заказ изменился, реплики перечитывают его из БД
+	EventInvalidate = "invalidate" // Заказ удален, реплики удаляют его из кэша
+	EventCreated    = "created"    // Заказы созданы, реплики снимают отметки полноты с их значений индексов
+)
+
+// Event событие кэша, которое реплика публикует для остальных
+type Event struct {
+	Type     string `json:"Type"`
+	OrderUID string `json:"OrderUID"`
+	Origin   string `json:"Origin"` // Идентификатор процесса-отправителя, свои события реплика пропускает
+	// Значения вторичных индексов созданных заказов, только для EventCreated
+	Indexes []cache.IndexValue `json:"Indexes,omitempty"`
+}
+
+// Cache кэш реплики, который сообщает остальным репликам об изменении и удалении заказов
+// через тему брокера и применяет такие же события от них
+type Cache struct {
+	cache.Cache
+	broker  natsclient.Broker
+	repo    repository.OrderRepository
+	subject string
+	origin  string
+}
+
+// New оборачивает кэш реплики. Отправитель событий определяется идентификатором, который
+// создается заново для каждого процесса: ClientID брокера для этого не годится, в JetStream
+// он не обязан быть уникальным и у реплик часто совпадает.
+func New(inner cache.Cache, broker natsclient.Broker, repo repository.OrderRepository, subject string) *Cache {
+	return &Cache{Cache: inner, broker: broker, repo: repo, subject: subject, origin: nuid.Next()}
+}
+
+// Start подписывается на тему событий кэша. Подписка не durable и получает только новые события:
+// после перезапуска реплика все равно загружает кэш заново.
+func (c *Cache) Start() error {
+	return c.broker.Subscribe(c.subject, c.handle, natsclient.NonDurable(), natsclient.DeliverNewOnly())
+}
+
+// Update заменяет заказ и сообщает остальным репликам, что его нужно перечитать
+func (c *Cache) Update(order models.Order) {
+	c.Cache.Update(order)
+	c.publish(Event{Type: EventRefresh, OrderUID: order.OrderUID})
+}
+
+// Created сообщает остальным репликам о новых заказах одним событием. Реплики не загружают
+// сами заказы, а только снимают отметки полноты с их значений вторичных индексов: иначе поиск
+// по значению, отмеченному полным, не увидел бы новый заказ, пока отметку не снимет вытеснение.
+func (c *Cache) Created(orders []models.Order) {
+	c.Cache.Created(orders)
+	var indexes []cache.IndexValue
+	seen := make(map[cache.IndexValue]bool)
+	for _, order := range orders {
+		for _, value := range cache.IndexValues(order) {
+			if !seen[value] {
+				seen[value] = true
+				indexes = append(indexes, value)
+			}
+		}
+	}
+	if len(indexes) > 0 {
+		c.publish(Event{Type: EventCreated, Indexes: indexes})
+	}
+}
+
+// Remove удаляет заказ и сообщает остальным репликам, что его нужно удалить
+func (c *Cache) Remove(orderUID string) {
+	c.Cache.Remove(orderUID)
+	c.publish(Event{Type: EventInvalidate, OrderUID: orderUID})
+}
+
+// publish отправляет событие кэша. Ошибка только логируется: кэш реплики уже обновлен,
+// а остальные реплики получат актуальный заказ после его вытеснения.
+func (c *Cache) publish(event Event) {
+	event.Origin = c.origin
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = c.broker.PublishMessage(c.subject, data)
+	}
+	if err != nil {
+		logger.Printf("Ошибка публикации события %s заказа %s: %v", event.Type, event.OrderUID, err)
+	}
+}
+
+// handle применяет событие другой реплики к своему кэшу, не публикуя его повторно
+func (c *Cache) handle(m *natsclient.Message) error {
+	var event Event
+	if err := json.Unmarshal(m.Data, &event); err != nil {
+		logger.Printf("Некорректное событие кэша %d: %v", m.Sequence, err)
+		return nil
+	}
+	if event.Origin == c.origin {
+		return nil
+	}
+
+	switch event.Type {
+	case EventRefresh:
+		// Перечитываются только заказы, которые уже есть в кэше реплики: остальные
+		// она загрузит из БД при первом запросе
+		if _, exists := c.Cache.Peek(event.OrderUID); !exists {
+			return nil
+		}
+		order, err := c.repo.GetByUID(event.OrderUID)
+		if err != nil {
+			// События не доставляются повторно, поэтому устаревший заказ удаляется,
+			// и следующий запрос прочитает его из БД
+			if !errors.Is(err, repository.ErrNotFound) {
+				logger.Printf("Ошибка загрузки заказа %s: %v", event.OrderUID, err)
+			}
+			c.Cache.Remove(event.OrderUID)
+			return nil
+		}
+		c.Cache.Add(order)
+	case EventInvalidate:
+		c.Cache.Remove(event.OrderUID)
+	case EventCreated:
+		for _, value := range event.Indexes {
+			c.Cache.ResetComplete(value.Index, value.Value)
+		}
+	default:
+		logger.Printf("Неизвестный тип события кэша: %s", event.Type)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package invalidation
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/models"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
+	"wild_project/src/tests"
+	"wild_project/src/tests/testdb"
+	"wild_project/src/utils"
+)
+
+func TestCacheEventsBetweenReplicas(t *testing.T) {
+	assert := assert.New(t)
+	srv, err := natsclient.StartEmbeddedServer("test-cluster")
+	if err != nil {
+		t.Fatalf("Не удалось запустить встроенный сервер: %v", err)
+	}
+	defer srv.Shutdown()
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+
+	// Две реплики с общей БД и своими кэшами
+	replicas := make([]*Cache, 2)
+	for i, clientID := range []string{"replica-1", "replica-2"} {
+		client, err := natsclient.NewNatsClient(srv.ClientURL(), "test-cluster", clientID)
+		if err != nil {
+			t.Fatalf("Не удалось подключиться: %v", err)
+		}
+		defer client.Close()
+		replicas[i] = New(cache.NewOrderCache(), client, repo, "cache-events")
+		assert.NoError(replicas[i].Start())
+	}
+
+	order := models.Order{OrderUID: "a", TrackNumber: "OLD"}
+	assert.NoError(db.Create(&order).Error)
+	for _, replica := range replicas {
+		replica.Add(order)
+	}
+
+	// Первая реплика изменила заказ в БД, вторая перечитывает его
+	assert.NoError(db.Model(&order).Update("track_number", "NEW").Error)
+	changed := order
+	changed.TrackNumber = "LOCAL"
+	replicas[0].Update(changed)
+	assert.Eventually(func() bool {
+		cached, _ := replicas[1].Get("a")
+		return cached.TrackNumber == "NEW"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Реплика пропускает свои события и не перечитывает заказ из БД
+	cached, _ := replicas[0].Get("a")
+	assert.Equal("LOCAL", cached.TrackNumber)
+
+	// Удаление заказа убирает его из кэша второй реплики
+	replicas[1].Remove("a")
+	assert.Eventually(func() bool {
+		_, exists := replicas[0].Get("a")
+		return !exists
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRefreshOfDeletedOrder(t *testing.T) {
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+	replica := New(cache.NewOrderCache(), broker, repo, "cache-events")
+	assert.NoError(t, replica.Start())
+
+	replica.Add(models.Order{OrderUID: "a"})
+	// Событие другой реплики о заказе, которого уже нет в БД
+	assert.NoError(t, broker.PublishMessage("cache-events", []byte(`{"Type":"refresh","OrderUID":"a","Origin":"replica-2"}`)))
+	assert.Eventually(t, func() bool {
+		_, exists := replica.Get("a")
+		return !exists
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReplicasWithSameClientID(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	// Реплики подключены к брокеру одинаково, как при общем ClientID в JetStream
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+	receiver := New(cache.NewOrderCache(), broker, repo, "cache-events")
+	sender := New(cache.NewOrderCache(), broker, repo, "cache-events")
+	assert.NoError(receiver.Start())
+
+	receiver.Add(models.Order{OrderUID: "a"})
+	sender.Remove("a")
+	assert.Eventually(func() bool {
+		_, exists := receiver.Get("a")
+		return !exists
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCreatedOrderResetsCompleteIndexOfReplica(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+	receiver := New(cache.NewOrderCache(), broker, repo, "cache-events")
+	sender := New(cache.NewOrderCache(), broker, repo, "cache-events")
+	assert.NoError(receiver.Start())
+
+	messages, err := tests.GenerateTestMessages(2)
+	assert.NoError(err)
+
+	// Реплика уже нашла в БД все заказы покупателя и отметила набор полным
+	var first models.Order
+	assert.NoError(json.Unmarshal([]byte(messages[0]), &first))
+	assert.NoError(repo.Create(&first))
+	receiver.AddFound(cache.IndexCustomerID, first.CustomerID, []models.Order{first})
+
+	// Другая реплика принимает новый заказ того же покупателя
+	result, err := utils.ProcessOrder(sender, repo, &natsclient.Message{Data: []byte(messages[1]), Sequence: 1}, false)
+	assert.NoError(err)
+	assert.Equal(utils.ResultInserted, result)
+
+	// Набор перестает быть полным, и следующий поиск найдет новый заказ в БД
+	assert.Eventually(func() bool {
+		_, complete := receiver.Find(cache.IndexCustomerID, first.CustomerID)
+		return !complete
+	}, 5*time.Second, 10*time.Millisecond)
+	_, exists := receiver.Peek("b563feb7b2b84b6test1")
+	assert.False(exists, "реплика не загружает новый заказ из БД")
+}
+
+func TestCreatedBatchPublishesOneEvent(t *testing.T) {
+	assert := assert.New(t)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+	sender := New(cache.NewOrderCache(), broker, repository.NewMemoryRepository(), "cache-events")
+
+	var events []Event
+	var mu sync.Mutex
+	assert.NoError(broker.Subscribe("cache-events", func(m *natsclient.Message) error {
+		var event Event
+		assert.NoError(json.Unmarshal(m.Data, &event))
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+		return nil
+	}, natsclient.NonDurable(), natsclient.DeliverNewOnly()))
+
+	orders := make([]models.Order, 100)
+	for i := range orders {
+		orders[i] = models.Order{OrderUID: fmt.Sprintf("order-%d", i), CustomerID: "c", TrackNumber: fmt.Sprintf("T%d", i)}
+		sender.Add(orders[i])
+	}
+	sender.Created(orders)
+
+	assert.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(events, 1) {
+		assert.Equal(EventCreated, events[0].Type)
+		// Общее значение покупателя передается один раз
+		assert.Len(events[0].Indexes, 101)
+	}
+}
+
+func TestRefreshOnlyHeldOrders(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+	receiver := New(cache.NewOrderCache(), broker, repo, "cache-events")
+	sender := New(cache.NewOrderCache(), broker, repo, "cache-events")
+	assert.NoError(receiver.Start())
+
+	held := models.Order{OrderUID: "held", TrackNumber: "OLD"}
+	other := models.Order{OrderUID: "other"}
+	assert.NoError(db.Create(&held).Error)
+	assert.NoError(db.Create(&other).Error)
+	receiver.Add(held)
+
+	sender.Update(other)
+	assert.NoError(db.Model(&held).Update("track_number", "NEW").Error)
+	sender.Update(held)
+	assert.Eventually(func() bool {
+		cached, _ := receiver.Get("held")
+		return cached.TrackNumber == "NEW"
+	}, 5*time.Second, 10*time.Millisecond)
+	// События обрабатываются по порядку, событие other уже применено
+	_, exists := receiver.Peek("other")
+	assert.False(exists, "реплика не загружает заказы, которых у нее не было")
+
+	// Если заказ не удалось перечитать, устаревшая копия удаляется
+	sqlDB, err := db.DB()
+	assert.NoError(err)
+	assert.NoError(sqlDB.Close())
+	sender.Update(held)
+	assert.Eventually(func() bool {
+		_, exists := receiver.Peek("held")
+		return !exists
+	}, 5*time.Second, 10*time.Millisecond)
+}
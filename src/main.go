@@ -1,7 +1,6 @@
 package main
 
 import (
-	"github.com/nats-io/stan.go"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"gorm.io/driver/postgres"
@@ -11,21 +10,22 @@ import (
 	"net/http"
 	"os"
 	"time"
+	"wild_project/src/audit"
 	"wild_project/src/cache"
+	"wild_project/src/config"
+	"wild_project/src/deadletter"
 	"wild_project/src/handlers"
-	"wild_project/src/models"
+	"wild_project/src/history"
+	"wild_project/src/ingest"
+	"wild_project/src/invalidation"
+	"wild_project/src/migrations"
 	natsclient "wild_project/src/nats"
+	"wild_project/src/replay"
+	"wild_project/src/repository"
 	"wild_project/src/tests"
 	"wild_project/src/utils"
 )
 
-const (
-	clusterID   = "my_cluster"
-	clientID    = "client-123"
-	natsURL     = "nats://localhost:4222"
-	channelName = "tests-channel"
-)
-
 var mainLog *log.Logger
 var filePath = "logs/mainLog.log"
 
@@ -39,12 +39,12 @@ func init() {
 	}, "CACHE: ", log.Ldate|log.Ltime|log.Lshortfile)
 }
 
-func loadAndCheckCache(orderCache *cache.OrderCache, db *gorm.DB) {
+func loadAndCheckCache(orderCache cache.Cache, repo repository.OrderRepository) {
 	// Проверка кеша до подключения к БД и после с сообщением о успешной загрузке кеша из БД
 	cacheSizeBefore := orderCache.Count()
 	mainLog.Printf("В кеше до загрузки даты : %d", cacheSizeBefore)
 	// Из БД в кеш
-	if err := orderCache.LoadFromDB(db); err != nil {
+	if err := orderCache.LoadFromDB(repo); err != nil {
 		mainLog.Fatalf("Ошибка в загрузке даты из БД: %v", err)
 	}
 	mainLog.Println("Дата успешно загрузилась")
@@ -53,7 +53,50 @@ func loadAndCheckCache(orderCache *cache.OrderCache, db *gorm.DB) {
 	mainLog.Printf("В кеше после загрузки даты : %d", cacheSizeAfter)
 }
 
+// warmUpCache загружает кэш из снимка и догоняет изменения, сделанные после него.
+// Если снимка нет или он поврежден, кэш загружается из БД целиком.
+func warmUpCache(cfg config.Config, orderCache *cache.OrderCache, repo repository.OrderRepository, client natsclient.Broker) {
+	if cfg.SnapshotPath == "off" {
+		loadAndCheckCache(orderCache, repo)
+		return
+	}
+	info, err := orderCache.LoadSnapshot(cfg.SnapshotPath)
+	if err != nil {
+		mainLog.Printf("Снимок кэша не загружен: %v", err)
+		loadAndCheckCache(orderCache, repo)
+		return
+	}
+	mainLog.Printf("Снимок кэша от %s загружен: %d заказов, сообщение %d", info.CreatedAt, info.Orders, info.Sequence)
+
+	if cfg.SnapshotCatchUp == "replay" {
+		// Перечитываем канал после сообщения из снимка, уже сохраненные заказы только добавляются в кэш
+		report, err := replay.Run(client, orderCache, repo, replay.Options{
+			Channel:       cfg.Channel,
+			StartSequence: info.Sequence + 1,
+			IdleTimeout:   2 * time.Second,
+		})
+		if err != nil {
+			mainLog.Fatalf("Ошибка при чтении канала после снимка: %v", err)
+		}
+		mainLog.Printf("Изменения после снимка прочитаны из канала: %+v", report)
+		// Удаления заказов в канал не попадают
+		removed, err := orderCache.DropDeleted(repo)
+		if err != nil {
+			mainLog.Fatalf("Ошибка при сверке снимка с БД: %v", err)
+		}
+		mainLog.Printf("Удаленные после снимка заказы убраны из кэша: %d", removed)
+		return
+	}
+	// Запас на расхождение часов реплик, которые записывают заказы
+	count, err := orderCache.CatchUpFromDB(repo, info.CreatedAt.Add(-time.Minute))
+	if err != nil {
+		mainLog.Fatalf("Ошибка при загрузке изменений после снимка из БД: %v", err)
+	}
+	mainLog.Printf("Изменения после снимка загружены из БД: %d заказов", count)
+}
+
 func main() {
+	cfg := config.Load()
 	cwd, _ := os.Getwd()
 	log.Println("Текущий рабочий каталог:", cwd)
 	// Инициализация логгера
@@ -68,39 +111,106 @@ func main() {
 		},
 	)
 	http.Handle("/metrics", promhttp.Handler())
-	// Подключение к NATS Streaming
-	client, err := natsclient.NewNatsClient(natsURL, clusterID, clientID)
+	// Подключение к брокеру, реализация выбирается в конфигурации
+	client, err := natsclient.NewBroker(cfg.Broker)
 	if err != nil {
 		mainLog.Fatalf("Ошибка в создании клиента NAts: %v", err)
 	}
 	defer client.Close()
+	handlers.RegisterHealthHandler(client)
 
 	// Подключение к базе данных
-	dsn := "user=admin password=root dbname=mydatabase sslmode=disable host=localhost port=5433"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: gormLogger})
+	db, err := gorm.Open(postgres.Open(cfg.DatabaseDSN), &gorm.Config{Logger: gormLogger})
 	if err != nil {
 		mainLog.Fatalf("Ошибка подключения к базе данных: %v", err)
 	}
 	mainLog.Println("Успешное подключение к базе данных")
 
-	// Автоматическая миграция моделей
-	err = db.AutoMigrate(&models.Order{}, &models.Delivery{}, &models.Payment{}, &models.Items{})
+	// Схема меняется только командой migrate, сервис проверяет, что она соответствует сборке
+	migrator, err := migrations.New(db)
 	if err != nil {
-		mainLog.Fatalf("Ошибка миграции: %v", err)
+		mainLog.Fatalf("Ошибка чтения миграций: %v", err)
+	}
+	if err := migrator.Check(); err != nil {
+		mainLog.Fatalf("Схема БД не готова, выполните go run ./src/cmd/migrate up: %v", err)
 	}
-	mainLog.Println("Миграция успешно завершена")
+	mainLog.Printf("Версия схемы БД: %d", migrator.Latest())
+	orders, err := repository.New(cfg.StorageBackend, db)
+	if err != nil {
+		mainLog.Fatalf("Ошибка в настройках хранилища заказов: %v", err)
+	}
+	// Изменения заказов записываются в историю в транзакции самого изменения
+	orderHistory := history.NewStore(db)
+	repo, err := history.Wrap(orders, orderHistory)
+	if err != nil {
+		mainLog.Fatalf("Ошибка подключения истории заказов: %v", err)
+	}
+	handlers.RegisterHistoryHandler(orderHistory)
 
 	// Инициализация кэша и копирование из бд
-	orderCache := cache.NewOrderCache()
-	loadAndCheckCache(orderCache, db)
-
-	// Подключение к NATS Streaming и подписка на канал
-	err = client.Subscribe(channelName, func(m *stan.Msg) {
-		mainLog.Printf("Получено новое сообщение: %s\n", string(m.Data))
+	orderCache, err := cache.New(cfg.Cache)
+	if err != nil {
+		mainLog.Fatalf("Ошибка в настройках кэша: %v", err)
+	}
+	if memoryCache, ok := orderCache.(*cache.OrderCache); ok {
+		warmUpCache(cfg, memoryCache, repo, client)
+		if cfg.SnapshotPath != "off" {
+			stopSnapshots := make(chan struct{})
+			defer close(stopSnapshots)
+			go memoryCache.RunSnapshots(cfg.SnapshotPath, cfg.SnapshotInterval, stopSnapshots)
+		}
+		// Изменения и удаления заказов рассылаются остальным репликам
+		if cfg.CacheEventsSubject != "off" {
+			replicaCache := invalidation.New(memoryCache, client, repo, cfg.CacheEventsSubject)
+			if err := replicaCache.Start(); err != nil {
+				mainLog.Fatalf("Ошибка при подписке на события кэша: %v", err)
+			}
+			orderCache = replicaCache
+		}
+	} else if orderCache.Count() == 0 {
+		// Общий кэш переживает перезапуск реплик, загружаем его из БД, только если он пуст
+		loadAndCheckCache(orderCache, repo)
+	}
+	handlers.RegisterAdminHandlers(orderCache, repo)
+
+	// Сверка кэша с БД по расписанию и по запросу
+	auditor := audit.New(orderCache, repo)
+	handlers.RegisterAuditHandler(auditor)
+	if cfg.AuditInterval > 0 {
+		stopAudit := make(chan struct{})
+		defer close(stopAudit)
+		go auditor.RunPeriodically(cfg.AuditInterval, audit.Options{Sample: cfg.AuditSample, Repair: cfg.AuditRepair}, stopAudit)
+	}
 
-		// Обработка сообщения
-		utils.ProcessNatsMessage(orderCache, db, m)
-	})
+	// Поиск заказов по трек-номеру, покупателю, транзакции и RID
+	handlers.RegisterLookupHandler(orderCache, repo)
+
+	// Карантин для сообщений, которые не удалось обработать
+	dlq := deadletter.NewQueue(db, client, cfg.DLQChannel, cfg.MaxRedeliveries)
+	handlers.RegisterDeadLetterHandlers(dlq)
+
+	// Подписка на канал заказов.
+	// Сообщение подтверждается только после записи в БД и кэш, иначе NATS доставит его повторно
+	orderHandler := utils.NewOrderHandler(orderCache, repo, dlq)
+	var submit natsclient.Handler
+	if cfg.IngestMode == "batch" {
+		// Заказы записываются в БД пачками
+		batcher := ingest.NewBatcher(orderCache, repo, orderHandler, cfg.BatchSize, cfg.BatchInterval)
+		defer batcher.Close()
+		submit = batcher.Submit
+	} else {
+		// Пул обработчиков: заказы с разными OrderUID обрабатываются параллельно
+		pool := ingest.NewPool(cfg.Workers, cfg.MaxInflight, orderHandler)
+		defer pool.Close()
+		submit = pool.Submit
+	}
+	err = client.Subscribe(cfg.Channel, submit,
+		natsclient.AsyncAck(),
+		natsclient.MaxInflight(cfg.MaxInflight),
+		natsclient.AckWait(cfg.AckWait),
+		natsclient.DurableName(cfg.DurableName),
+		natsclient.QueueGroup(cfg.QueueGroup),
+	)
 	if err != nil {
 		mainLog.Fatalf("Ошибка при подписке на канал NATS: %v", err)
 	}
@@ -112,7 +222,7 @@ func main() {
 	}
 
 	for _, message := range messages {
-		if err := client.PublishMessage(channelName, []byte(message)); err != nil {
+		if err := client.PublishMessage(cfg.Channel, []byte(message)); err != nil {
 			mainLog.Printf("Ошибка при отправке сообщения: %v", err)
 		}
 	}
@@ -125,14 +235,14 @@ func main() {
 		}
 
 		for _, message := range messages {
-			err = client.PublishMessage(channelName, []byte(message))
+			err = client.PublishMessage(cfg.Channel, []byte(message))
 			if err != nil {
 				mainLog.Printf("Ошибка при отправке сообщения: %v", err)
 			}
 		}
 	}()
 	// Запуск HTTP-сервера
-	if err := handlers.StartServer(orderCache, db, client, "8080"); err != nil {
+	if err := handlers.StartServer(orderCache, repo, client, "8080"); err != nil {
 		log.Fatalf("Ошибка во время запуска HTTP серваака: %v", err)
 	}
 	select {}
@@ -0,0 +1,312 @@
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Файлы миграций лежат в sql/ парами NNNN_name.up.sql и NNNN_name.down.sql
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey ключ advisory lock PostgreSQL, под которым реплики и команда migrate меняют схему по очереди
+const lockKey int64 = 0x77696c645f6d6967
+
+// ErrVersionMismatch версия схемы БД не совпадает с последней миграцией в сборке
+var ErrVersionMismatch = errors.New("версия схемы БД не совпадает с версией сервиса")
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration одна версия схемы: SQL для перехода на нее и для отката
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// appliedMigration строка таблицы schema_migrations
+type appliedMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status состояние миграции в БД. Known false - миграция применена, но ее нет в сборке.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Known     bool
+}
+
+// Migrator применяет и откатывает миграции. Каждая миграция выполняется в своей транзакции
+// вместе с записью в schema_migrations, поэтому схема не остается в промежуточном состоянии.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New создает Migrator со встроенными в сборку миграциями
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Load(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load читает миграции из каталога dir в порядке версий. У каждой версии должны быть оба файла.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("неожиданный файл миграции %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("у миграции %d разные имена: %s и %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("у миграции %04d_%s нет файла up или down", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest возвращает версию последней миграции в сборке
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// applied возвращает примененные миграции в порядке версий
+func applied(db *gorm.DB) ([]appliedMigration, error) {
+	if !db.Migrator().HasTable(&appliedMigration{}) {
+		return nil, nil
+	}
+	var rows []appliedMigration
+	err := db.Order("version").Find(&rows).Error
+	return rows, err
+}
+
+// Current возвращает последнюю примененную версию, 0 - схема еще не создавалась
+func (m *Migrator) Current() (int, error) {
+	rows, err := applied(m.db)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[len(rows)-1].Version, nil
+}
+
+// Status возвращает все миграции из сборки и из БД в порядке версий
+func (m *Migrator) Status() ([]Status, error) {
+	rows, err := applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Status)
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = &Status{Version: migration.Version, Name: migration.Name, Known: true}
+	}
+	for _, row := range rows {
+		s, exists := byVersion[row.Version]
+		if !exists {
+			s = &Status{Version: row.Version, Name: row.Name}
+			byVersion[row.Version] = s
+		}
+		s.Applied = true
+		s.AppliedAt = row.AppliedAt
+	}
+	statuses := make([]Status, 0, len(byVersion))
+	for _, s := range byVersion {
+		statuses = append(statuses, *s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Check возвращает ErrVersionMismatch, если в БД применены не ровно все миграции сборки.
+// Сервис не стартует со схемой, для которой он не собран.
+func (m *Migrator) Check() error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if !s.Applied || !s.Known {
+			return fmt.Errorf("%w: в БД версия %d, сервису нужна %d", ErrVersionMismatch, current, m.Latest())
+		}
+	}
+	return nil
+}
+
+// Up применяет все непримененные миграции и возвращает их
+func (m *Migrator) Up() ([]Migration, error) {
+	return m.To(m.Latest())
+}
+
+// Down откатывает последние steps примененных миграций и возвращает их в порядке отката
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(func(conn *gorm.DB) error {
+		rows, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(rows) - 1; i >= 0 && len(done) < steps; i-- {
+			migration, err := m.revert(conn, rows[i])
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// To приводит схему к версии version: применяет миграции до нее включительно
+// и откатывает примененные миграции с большими версиями. Возвращает выполненные миграции.
+func (m *Migrator) To(version int) ([]Migration, error) {
+	if version != 0 && m.find(version) == nil {
+		return nil, fmt.Errorf("миграции %d нет в сборке", version)
+	}
+	var done []Migration
+	err := m.locked(func(conn *gorm.DB) error {
+		rows, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(rows) - 1; i >= 0 && rows[i].Version > version; i-- {
+			migration, err := m.revert(conn, rows[i])
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		isApplied := make(map[int]bool, len(rows))
+		for _, row := range rows {
+			isApplied[row.Version] = true
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > version || isApplied[migration.Version] {
+				continue
+			}
+			if err := m.apply(conn, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// apply выполняет миграцию и записывает ее в schema_migrations в одной транзакции
+func (m *Migrator) apply(conn *gorm.DB, migration Migration) error {
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(migration.Up).Error; err != nil {
+			return err
+		}
+		return tx.Create(&appliedMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("миграция %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+// revert откатывает примененную миграцию и удаляет ее из schema_migrations в одной транзакции
+func (m *Migrator) revert(conn *gorm.DB, row appliedMigration) (Migration, error) {
+	migration := m.find(row.Version)
+	if migration == nil {
+		return Migration{}, fmt.Errorf("нельзя откатить миграцию %d: ее нет в сборке", row.Version)
+	}
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(migration.Down).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&appliedMigration{Version: migration.Version}).Error
+	})
+	if err != nil {
+		return Migration{}, fmt.Errorf("откат миграции %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return *migration, nil
+}
+
+// locked выполняет fn на одном соединении под advisory lock, чтобы реплики и команда migrate,
+// запущенные одновременно, не применяли миграции параллельно. В SQLite для тестов блокировки нет,
+// ее заменяет блокировка файла БД.
+func (m *Migrator) locked(fn func(conn *gorm.DB) error) error {
+	return m.db.Connection(func(conn *gorm.DB) error {
+		if conn.Dialector.Name() == "postgres" {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error; err != nil {
+				return err
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", lockKey)
+		}
+		if err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`).Error; err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
@@ -0,0 +1,143 @@
+package migrations
+
+import (
+	"errors"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+var testFiles = fstest.MapFS{
+	"sql/0001_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT);")},
+	"sql/0001_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+	"sql/0002_color.up.sql": {Data: []byte(`ALTER TABLE widgets ADD COLUMN color TEXT;
+CREATE INDEX idx_widgets_color ON widgets (color);`)},
+	"sql/0002_color.down.sql":   {Data: []byte("DROP INDEX idx_widgets_color; ALTER TABLE widgets DROP COLUMN color;")},
+	"sql/0003_gadgets.up.sql":   {Data: []byte("CREATE TABLE gadgets (id INTEGER PRIMARY KEY);")},
+	"sql/0003_gadgets.down.sql": {Data: []byte("DROP TABLE gadgets;")},
+}
+
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrations, err := Load(fsys, "sql")
+	require.NoError(t, err)
+	return &Migrator{db: db, migrations: migrations}
+}
+
+func versions(migrations []Migration) []int {
+	var result []int
+	for _, m := range migrations {
+		result = append(result, m.Version)
+	}
+	return result
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load(files, "sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "версии идут подряд")
+	}
+}
+
+func TestLoadRejectsMissingDown(t *testing.T) {
+	_, err := Load(fstest.MapFS{"sql/0001_a.up.sql": {Data: []byte("SELECT 1;")}}, "sql")
+	assert.Error(t, err)
+
+	_, err = Load(fstest.MapFS{"sql/readme.txt": {Data: []byte("")}}, "sql")
+	assert.Error(t, err)
+}
+
+func TestUpDownTo(t *testing.T) {
+	m := newTestMigrator(t, testFiles)
+	assert.ErrorIs(t, m.Check(), ErrVersionMismatch)
+
+	done, err := m.Up()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, versions(done))
+	require.NoError(t, m.Check())
+	assert.True(t, m.db.Migrator().HasColumn("widgets", "color"))
+
+	// Повторный запуск ничего не делает
+	done, err = m.Up()
+	require.NoError(t, err)
+	assert.Empty(t, done)
+
+	done, err = m.Down(1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, versions(done))
+	assert.False(t, m.db.Migrator().HasTable("gadgets"))
+	assert.ErrorIs(t, m.Check(), ErrVersionMismatch)
+
+	done, err = m.To(1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, versions(done))
+	assert.False(t, m.db.Migrator().HasColumn("widgets", "color"))
+	current, err := m.Current()
+	require.NoError(t, err)
+	assert.Equal(t, 1, current)
+
+	done, err = m.To(3)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, versions(done))
+
+	done, err = m.To(0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 2, 1}, versions(done))
+	assert.False(t, m.db.Migrator().HasTable("widgets"))
+
+	_, err = m.To(7)
+	assert.Error(t, err)
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0001_widgets.up.sql":   testFiles["sql/0001_widgets.up.sql"],
+		"sql/0001_widgets.down.sql": testFiles["sql/0001_widgets.down.sql"],
+		"sql/0002_broken.up.sql":    {Data: []byte("CREATE TABLE broken (id INTEGER); ALTER TABLE missing ADD COLUMN x TEXT;")},
+		"sql/0002_broken.down.sql":  {Data: []byte("DROP TABLE broken;")},
+	}
+	m := newTestMigrator(t, fsys)
+
+	done, err := m.Up()
+	require.Error(t, err)
+	assert.Equal(t, []int{1}, versions(done))
+	current, err := m.Current()
+	require.NoError(t, err)
+	assert.Equal(t, 1, current)
+	assert.False(t, m.db.Migrator().HasTable("broken"), "миграция откатывается целиком")
+}
+
+func TestStatusReportsUnknownMigrations(t *testing.T) {
+	m := newTestMigrator(t, testFiles)
+	_, err := m.Up()
+	require.NoError(t, err)
+
+	// Сборка старше схемы: миграции 3 в ней нет
+	older := newTestMigrator(t, testFiles)
+	older.db = m.db
+	older.migrations = older.migrations[:2]
+
+	statuses, err := older.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.True(t, statuses[2].Applied)
+	assert.False(t, statuses[2].Known)
+	assert.True(t, errors.Is(older.Check(), ErrVersionMismatch))
+
+	_, err = older.Down(1)
+	assert.Error(t, err, "нельзя откатить миграцию, которой нет в сборке")
+}
@@ -0,0 +1,132 @@
+package migrations
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+	"wild_project/src/tests/testdb"
+)
+
+// Модели первой версии сервиса: такую схему создавал db.AutoMigrate до появления миграций,
+// без версий заказа, индексов поиска и карантина
+type baselineOrder struct {
+	gorm.Model
+	OrderUID          string `gorm:"uniqueIndex"`
+	TrackNumber       string
+	Entry             string
+	Delivery          baselineDelivery `gorm:"foreignKey:OrderID"`
+	Payment           baselinePayment  `gorm:"foreignKey:OrderID"`
+	Items             []baselineItem   `gorm:"foreignKey:OrderID"`
+	Locale            string
+	InternalSignature string
+	CustomerID        string
+	DeliveryService   string
+	Shardkey          string
+	SmID              string
+	DateCreated       time.Time
+	OofShard          string
+}
+
+type baselineDelivery struct {
+	gorm.Model
+	Name, Phone, Zip, City, Adress, Region, Email string
+	OrderID                                       uint
+}
+
+type baselinePayment struct {
+	gorm.Model
+	Transaction, RequestID, Currency, Provider string
+	Amount, PaymentDt                          int
+	Bank                                       string
+	DeliveryCost, GoodsTotal, CustomFee        int
+	OrderID                                    uint
+}
+
+type baselineItem struct {
+	gorm.Model
+	ChrtID      int
+	TrackNumber string
+	Price       int
+	RID         string
+	Name        string
+	Sale        int
+	Size        string
+	TotalPrice  int
+	NmID        int
+	Brand       string
+	Status      int
+	OrderID     uint
+}
+
+func (baselineOrder) TableName() string    { return "orders" }
+func (baselineDelivery) TableName() string { return "deliveries" }
+func (baselinePayment) TableName() string  { return "payments" }
+func (baselineItem) TableName() string     { return "items" }
+
+// Обновление базы, созданной AutoMigrate первой версии, встроенными миграциями PostgreSQL
+func TestUpgradeBaselineDatabase(t *testing.T) {
+	db := testdb.OpenPostgres(t)
+	require.NoError(t, db.AutoMigrate(&baselineOrder{}, &baselineDelivery{}, &baselinePayment{}, &baselineItem{}))
+	require.NoError(t, db.Create(&baselineOrder{
+		OrderUID: "old", TrackNumber: "T1", DateCreated: time.Now(),
+		Delivery: baselineDelivery{City: "Moscow"},
+		Payment:  baselinePayment{Transaction: "tx-old", Amount: 100},
+		Items:    []baselineItem{{ChrtID: 1, RID: "rid-1", Price: 10}, {ChrtID: 2, RID: "rid-2"}},
+	}).Error)
+
+	m, err := New(db)
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.Check(), ErrVersionMismatch)
+	_, err = m.Up()
+	require.NoError(t, err)
+	require.NoError(t, m.Check())
+
+	// Заказ первой версии читается через новую схему со связанными записями
+	order, err := repository.NewGormRepository(db).GetByUID("old")
+	require.NoError(t, err)
+	assert.Equal(t, "Moscow", order.Delivery.City)
+	assert.Equal(t, "tx-old", order.Payment.Transaction)
+	assert.Len(t, order.Items, 2)
+	assert.Equal(t, 0, order.Version)
+}
+
+// Все встроенные миграции применяются к пустой базе, откатываются и применяются снова
+func TestEmbeddedMigrationsUpDown(t *testing.T) {
+	db := testdb.OpenPostgres(t)
+	m, err := New(db)
+	require.NoError(t, err)
+
+	_, err = m.Up()
+	require.NoError(t, err)
+	_, err = m.To(0)
+	require.NoError(t, err)
+	assert.False(t, db.Migrator().HasTable("orders"))
+	_, err = m.Up()
+	require.NoError(t, err)
+	require.NoError(t, m.Check())
+
+	// Схема миграций совпадает с тем, что ожидают хранилища
+	for _, repo := range []repository.OrderRepository{repository.NewGormRepository(db), repository.NewDocumentRepository(db)} {
+		order := models.Order{OrderUID: "a", TrackNumber: "T", DateCreated: time.Now(),
+			Payment: models.Payment{Transaction: "tx"}, Items: []models.Items{{ChrtID: 1, RID: "rid"}}}
+		require.NoError(t, repo.Create(&order))
+		found, err := repo.FindBy(repository.FieldRID, "rid")
+		require.NoError(t, err)
+		assert.Len(t, found, 1)
+		other := models.Order{OrderUID: "b", Payment: models.Payment{Transaction: "tx"}}
+		assert.ErrorIs(t, repo.Create(&other), repository.ErrDuplicateTransaction)
+		bad := models.Order{OrderUID: "c", Items: []models.Items{{Price: -1}}}
+		assert.ErrorIs(t, repo.Create(&bad), repository.ErrConstraintViolation)
+	}
+
+	// Журнал изменений только дополняется
+	document := `{"OrderUID":"a"}`
+	entry := models.OrderHistory{OrderUID: "a", Current: &document}
+	require.NoError(t, db.Create(&entry).Error)
+	assert.Error(t, db.Model(&entry).Update("source", "changed").Error)
+	assert.Error(t, db.Delete(&entry).Error)
+}
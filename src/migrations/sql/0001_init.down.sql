@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS quarantined_messages;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS deliveries;
+DROP TABLE IF EXISTS orders;
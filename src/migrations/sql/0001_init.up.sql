@@ -0,0 +1,104 @@
+-- Схема, которую раньше создавал db.AutoMigrate при старте сервиса.
+-- IF NOT EXISTS позволяет принять под управление миграций уже созданную базу, в том числе
+-- созданную первыми версиями сервиса: столбцы, появившиеся позже, добавляются отдельно.
+
+CREATE TABLE IF NOT EXISTS orders (
+    id                 BIGSERIAL PRIMARY KEY,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    deleted_at         TIMESTAMPTZ,
+    order_uid          TEXT,
+    track_number       TEXT,
+    entry              TEXT,
+    locale             TEXT,
+    internal_signature TEXT,
+    customer_id        TEXT,
+    delivery_service   TEXT,
+    shardkey           TEXT,
+    sm_id              TEXT,
+    date_created       TIMESTAMPTZ,
+    oof_shard          TEXT,
+    version            BIGINT,
+    cancelled_at       TIMESTAMPTZ
+);
+-- Версия и отмена заказа появились вместе с событиями изменения заказа
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version BIGINT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_order_uid ON orders (order_uid);
+CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders (track_number);
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders (customer_id);
+CREATE INDEX IF NOT EXISTS idx_orders_deleted_at ON orders (deleted_at);
+
+CREATE TABLE IF NOT EXISTS deliveries (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    name       TEXT,
+    phone      TEXT,
+    zip        TEXT,
+    city       TEXT,
+    adress     TEXT,
+    region     TEXT,
+    email      TEXT,
+    order_id   BIGINT,
+    CONSTRAINT fk_orders_delivery FOREIGN KEY (order_id) REFERENCES orders (id)
+);
+CREATE INDEX IF NOT EXISTS idx_deliveries_deleted_at ON deliveries (deleted_at);
+
+CREATE TABLE IF NOT EXISTS payments (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ,
+    transaction   TEXT,
+    request_id    TEXT,
+    currency      TEXT,
+    provider      TEXT,
+    amount        BIGINT,
+    payment_dt    BIGINT,
+    bank          TEXT,
+    delivery_cost BIGINT,
+    goods_total   BIGINT,
+    custom_fee    BIGINT,
+    order_id      BIGINT,
+    CONSTRAINT fk_orders_payment FOREIGN KEY (order_id) REFERENCES orders (id)
+);
+CREATE INDEX IF NOT EXISTS idx_payments_transaction ON payments (transaction);
+CREATE INDEX IF NOT EXISTS idx_payments_deleted_at ON payments (deleted_at);
+
+CREATE TABLE IF NOT EXISTS items (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    chrt_id      BIGINT,
+    track_number TEXT,
+    price        BIGINT,
+    r_id         TEXT,
+    name         TEXT,
+    sale         BIGINT,
+    size         TEXT,
+    total_price  BIGINT,
+    nm_id        BIGINT,
+    brand        TEXT,
+    status       BIGINT,
+    order_id     BIGINT,
+    CONSTRAINT fk_orders_items FOREIGN KEY (order_id) REFERENCES orders (id)
+);
+CREATE INDEX IF NOT EXISTS idx_items_r_id ON items (r_id);
+CREATE INDEX IF NOT EXISTS idx_items_deleted_at ON items (deleted_at);
+
+CREATE TABLE IF NOT EXISTS quarantined_messages (
+    id               BIGSERIAL PRIMARY KEY,
+    created_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ,
+    deleted_at       TIMESTAMPTZ,
+    channel          TEXT,
+    data             BYTEA,
+    sequence         BIGINT,
+    redelivery_count BIGINT,
+    reason           TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_quarantined_messages_channel ON quarantined_messages (channel);
+CREATE INDEX IF NOT EXISTS idx_quarantined_messages_deleted_at ON quarantined_messages (deleted_at);
@@ -0,0 +1,49 @@
+DROP INDEX idx_items_chrt_id;
+DROP INDEX idx_items_order_uid;
+ALTER TABLE items ADD COLUMN order_id BIGINT;
+UPDATE items i SET order_id = o.id FROM orders o WHERE o.order_uid = i.order_uid;
+ALTER TABLE items
+    DROP CONSTRAINT chk_items_sale,
+    DROP CONSTRAINT chk_items_total_price,
+    DROP CONSTRAINT chk_items_price,
+    DROP CONSTRAINT fk_orders_items,
+    DROP COLUMN order_uid,
+    ALTER COLUMN total_price DROP NOT NULL,
+    ALTER COLUMN sale DROP NOT NULL,
+    ALTER COLUMN price DROP NOT NULL,
+    ALTER COLUMN r_id DROP NOT NULL,
+    ALTER COLUMN chrt_id DROP NOT NULL;
+ALTER TABLE items ADD CONSTRAINT fk_orders_items FOREIGN KEY (order_id) REFERENCES orders (id);
+
+DROP INDEX idx_payments_transaction;
+CREATE INDEX idx_payments_transaction ON payments (transaction);
+DROP INDEX idx_payments_order_uid;
+ALTER TABLE payments ADD COLUMN order_id BIGINT;
+UPDATE payments p SET order_id = o.id FROM orders o WHERE o.order_uid = p.order_uid;
+ALTER TABLE payments
+    DROP CONSTRAINT chk_payments_custom_fee,
+    DROP CONSTRAINT chk_payments_goods_total,
+    DROP CONSTRAINT chk_payments_delivery_cost,
+    DROP CONSTRAINT chk_payments_amount,
+    DROP CONSTRAINT fk_orders_payment,
+    DROP COLUMN order_uid,
+    ALTER COLUMN custom_fee DROP NOT NULL,
+    ALTER COLUMN goods_total DROP NOT NULL,
+    ALTER COLUMN delivery_cost DROP NOT NULL,
+    ALTER COLUMN amount DROP NOT NULL;
+ALTER TABLE payments ADD CONSTRAINT fk_orders_payment FOREIGN KEY (order_id) REFERENCES orders (id);
+
+DROP INDEX idx_deliveries_order_uid;
+ALTER TABLE deliveries ADD COLUMN order_id BIGINT;
+UPDATE deliveries d SET order_id = o.id FROM orders o WHERE o.order_uid = d.order_uid;
+ALTER TABLE deliveries
+    DROP CONSTRAINT fk_orders_delivery,
+    DROP COLUMN order_uid;
+ALTER TABLE deliveries ADD CONSTRAINT fk_orders_delivery FOREIGN KEY (order_id) REFERENCES orders (id);
+
+DROP INDEX idx_orders_date_created;
+ALTER TABLE orders
+    DROP CONSTRAINT chk_orders_order_uid,
+    ALTER COLUMN version DROP NOT NULL,
+    ALTER COLUMN track_number DROP NOT NULL,
+    ALTER COLUMN order_uid DROP NOT NULL;
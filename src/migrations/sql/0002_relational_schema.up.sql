@@ -0,0 +1,66 @@
+-- Доставка, оплата и позиции ссылаются на заказ по order_uid и удаляются вместе с ним.
+-- Миграция не применится, если в БД уже есть повторяющиеся транзакции оплаты или
+-- отрицательные суммы: такие записи нужно исправить вручную.
+
+UPDATE orders SET version = 0 WHERE version IS NULL;
+ALTER TABLE orders
+    ALTER COLUMN order_uid SET NOT NULL,
+    ALTER COLUMN track_number SET NOT NULL,
+    ALTER COLUMN version SET NOT NULL,
+    ADD CONSTRAINT chk_orders_order_uid CHECK (order_uid <> '');
+CREATE INDEX idx_orders_date_created ON orders (date_created);
+
+-- Записи без заказа остались от мягкого удаления, ссылаться им не на что
+DELETE FROM deliveries WHERE order_id IS NULL OR order_id NOT IN (SELECT id FROM orders);
+DELETE FROM payments WHERE order_id IS NULL OR order_id NOT IN (SELECT id FROM orders);
+DELETE FROM items WHERE order_id IS NULL OR order_id NOT IN (SELECT id FROM orders);
+
+ALTER TABLE deliveries ADD COLUMN order_uid TEXT;
+UPDATE deliveries d SET order_uid = o.order_uid FROM orders o WHERE o.id = d.order_id;
+ALTER TABLE deliveries
+    ALTER COLUMN order_uid SET NOT NULL,
+    DROP CONSTRAINT IF EXISTS fk_orders_delivery,
+    DROP COLUMN order_id;
+ALTER TABLE deliveries
+    ADD CONSTRAINT fk_orders_delivery FOREIGN KEY (order_uid) REFERENCES orders (order_uid) ON DELETE CASCADE;
+CREATE UNIQUE INDEX idx_deliveries_order_uid ON deliveries (order_uid);
+
+ALTER TABLE payments ADD COLUMN order_uid TEXT;
+UPDATE payments p SET order_uid = o.order_uid FROM orders o WHERE o.id = p.order_id;
+ALTER TABLE payments
+    ALTER COLUMN order_uid SET NOT NULL,
+    ALTER COLUMN amount SET NOT NULL,
+    ALTER COLUMN delivery_cost SET NOT NULL,
+    ALTER COLUMN goods_total SET NOT NULL,
+    ALTER COLUMN custom_fee SET NOT NULL,
+    DROP CONSTRAINT IF EXISTS fk_orders_payment,
+    DROP COLUMN order_id;
+ALTER TABLE payments
+    ADD CONSTRAINT fk_orders_payment FOREIGN KEY (order_uid) REFERENCES orders (order_uid) ON DELETE CASCADE,
+    ADD CONSTRAINT chk_payments_amount CHECK (amount >= 0),
+    ADD CONSTRAINT chk_payments_delivery_cost CHECK (delivery_cost >= 0),
+    ADD CONSTRAINT chk_payments_goods_total CHECK (goods_total >= 0),
+    ADD CONSTRAINT chk_payments_custom_fee CHECK (custom_fee >= 0);
+CREATE UNIQUE INDEX idx_payments_order_uid ON payments (order_uid);
+-- Пустая транзакция означает, что она неизвестна, и не участвует в уникальности
+DROP INDEX idx_payments_transaction;
+CREATE UNIQUE INDEX idx_payments_transaction ON payments (transaction) WHERE transaction <> '';
+
+ALTER TABLE items ADD COLUMN order_uid TEXT;
+UPDATE items i SET order_uid = o.order_uid FROM orders o WHERE o.id = i.order_id;
+ALTER TABLE items
+    ALTER COLUMN order_uid SET NOT NULL,
+    ALTER COLUMN chrt_id SET NOT NULL,
+    ALTER COLUMN r_id SET NOT NULL,
+    ALTER COLUMN price SET NOT NULL,
+    ALTER COLUMN sale SET NOT NULL,
+    ALTER COLUMN total_price SET NOT NULL,
+    DROP CONSTRAINT IF EXISTS fk_orders_items,
+    DROP COLUMN order_id;
+ALTER TABLE items
+    ADD CONSTRAINT fk_orders_items FOREIGN KEY (order_uid) REFERENCES orders (order_uid) ON DELETE CASCADE,
+    ADD CONSTRAINT chk_items_price CHECK (price >= 0),
+    ADD CONSTRAINT chk_items_total_price CHECK (total_price >= 0),
+    ADD CONSTRAINT chk_items_sale CHECK (sale >= 0 AND sale <= 100);
+CREATE INDEX idx_items_order_uid ON items (order_uid);
+CREATE INDEX idx_items_chrt_id ON items (chrt_id);
@@ -0,0 +1,2 @@
+DROP TABLE order_documents;
+DROP FUNCTION order_document_date(JSONB);
@@ -0,0 +1,29 @@
+-- Хранилище документов: заказ целиком одним JSONB документом (STORAGE_BACKEND=document).
+-- Поля для поиска вычисляются из документа, транзакция и RID ищутся по индексам документа.
+
+-- Приведение текста к timestamptz не считается IMMUTABLE из-за часового пояса сессии,
+-- но время в документе всегда записано со смещением, поэтому результат от него не зависит
+CREATE FUNCTION order_document_date(document JSONB) RETURNS TIMESTAMPTZ
+    LANGUAGE sql IMMUTABLE
+    AS $$ SELECT (document ->> 'DateCreated')::timestamptz $$;
+
+CREATE TABLE order_documents (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL,
+    document     JSONB NOT NULL,
+    order_uid    TEXT GENERATED ALWAYS AS (document ->> 'OrderUID') STORED NOT NULL,
+    track_number TEXT GENERATED ALWAYS AS (document ->> 'TrackNumber') STORED,
+    customer_id  TEXT GENERATED ALWAYS AS (document ->> 'CustomerID') STORED,
+    date_created TIMESTAMPTZ GENERATED ALWAYS AS (order_document_date(document)) STORED,
+    version      BIGINT GENERATED ALWAYS AS ((document ->> 'Version')::bigint) STORED NOT NULL,
+    CONSTRAINT chk_order_documents_order_uid CHECK (order_uid <> '')
+);
+CREATE UNIQUE INDEX idx_order_documents_order_uid ON order_documents (order_uid);
+CREATE INDEX idx_order_documents_track_number ON order_documents (track_number);
+CREATE INDEX idx_order_documents_customer_id ON order_documents (customer_id);
+CREATE INDEX idx_order_documents_date_created ON order_documents (date_created);
+CREATE UNIQUE INDEX idx_order_documents_transaction ON order_documents ((document -> 'payment' ->> 'Transaction'))
+    WHERE document -> 'payment' ->> 'Transaction' <> '';
+-- Поиск по содержимому документа, например позиции с заданным RID: document @> '{"items":[{"RID":"..."}]}'
+CREATE INDEX idx_order_documents_document ON order_documents USING GIN (document jsonb_path_ops);
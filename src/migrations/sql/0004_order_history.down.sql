@@ -0,0 +1,2 @@
+DROP TABLE order_history;
+DROP FUNCTION order_history_append_only();
@@ -0,0 +1,25 @@
+-- Журнал изменений заказов. Записи только добавляются и переживают удаление заказа,
+-- поэтому внешнего ключа на orders нет.
+CREATE TABLE order_history (
+    id         BIGSERIAL PRIMARY KEY,
+    order_uid  TEXT NOT NULL,
+    source     TEXT,
+    previous   JSONB,
+    current    JSONB,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT chk_order_history_documents CHECK (previous IS NOT NULL OR current IS NOT NULL)
+);
+CREATE INDEX idx_order_history_order_uid ON order_history (order_uid);
+CREATE INDEX idx_order_history_created_at ON order_history (created_at);
+
+CREATE FUNCTION order_history_append_only() RETURNS TRIGGER
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    RAISE EXCEPTION 'order_history: записи журнала нельзя изменять или удалять';
+END
+$$;
+
+CREATE TRIGGER order_history_append_only
+    BEFORE UPDATE OR DELETE ON order_history
+    FOR EACH ROW EXECUTE FUNCTION order_history_append_only();
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Change различие одного поля заказа. Путь составляется из JSON-имен полей,
+// например delivery.City или items[1].Status.
+type Change struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	modelType = reflect.TypeOf(gorm.Model{})
+)
+
+// keyed запись, которую Diff сопоставляет по ключу, а не по месту в срезе
+type keyed interface {
+	diffKey() string
+}
+
+// diffKey позиция заказа определяется товаром и RID: при замене заказа позиции создаются заново
+// с новыми id и могут прийти в другом порядке
+func (i Items) diffKey() string {
+	return fmt.Sprintf("%d/%s", i.ChrtID, i.RID)
+}
+
+// Diff сравнивает два заказа поле за полем, включая доставку, оплату и позиции.
+// Служебные поля хранения не сравниваются: gorm.Model записей и поля с тегом diff:"-",
+// например OrderUID доставки, оплаты и позиций. Позиции сопоставляются по ChrtID и RID,
+// путь позиции содержит ее номер в новом заказе, а для удаленной - в старом.
+// Время считается одинаковым с точностью до микросекунды, с которой его хранит Postgres.
+func Diff(old, new Order) []Change {
+	var changes []Change
+	diffValues("", reflect.ValueOf(old), reflect.ValueOf(new), &changes)
+	return changes
+}
+
+func diffValues(path string, a, b reflect.Value, changes *[]Change) {
+	switch {
+	case a.Type() == timeType:
+		d := a.Interface().(time.Time).Sub(b.Interface().(time.Time))
+		if d >= time.Microsecond || d <= -time.Microsecond {
+			*changes = append(*changes, Change{path, a.Interface(), b.Interface()})
+		}
+	case a.Kind() == reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if skipped(field) {
+				continue
+			}
+			fieldPath := path
+			// Поля других встроенных структур сравниваются как поля самой записи
+			if !field.Anonymous {
+				fieldPath = joinPath(path, fieldName(field))
+			}
+			diffValues(fieldPath, a.Field(i), b.Field(i), changes)
+		}
+	case a.Kind() == reflect.Slice && a.Type().Elem().Implements(reflect.TypeOf((*keyed)(nil)).Elem()):
+		diffKeyed(path, a, b, changes)
+	case a.Kind() == reflect.Slice:
+		for i := 0; i < a.Len() || i < b.Len(); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= a.Len():
+				*changes = append(*changes, Change{itemPath, nil, significant(b.Index(i))})
+			case i >= b.Len():
+				*changes = append(*changes, Change{itemPath, significant(a.Index(i)), nil})
+			default:
+				diffValues(itemPath, a.Index(i), b.Index(i), changes)
+			}
+		}
+	case a.Kind() == reflect.Pointer:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*changes = append(*changes, Change{path, a.Interface(), b.Interface()})
+			}
+			return
+		}
+		diffValues(path, a.Elem(), b.Elem(), changes)
+	default:
+		if a.Interface() != b.Interface() {
+			*changes = append(*changes, Change{path, a.Interface(), b.Interface()})
+		}
+	}
+}
+
+// diffKeyed сравнивает срезы записей, сопоставляя их по ключу. Записи с одинаковым ключом
+// сопоставляются по порядку.
+func diffKeyed(path string, a, b reflect.Value, changes *[]Change) {
+	unmatched := make(map[string][]int)
+	for i := 0; i < a.Len(); i++ {
+		key := a.Index(i).Interface().(keyed).diffKey()
+		unmatched[key] = append(unmatched[key], i)
+	}
+	matched := make([]bool, a.Len())
+	for i := 0; i < b.Len(); i++ {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		key := b.Index(i).Interface().(keyed).diffKey()
+		if candidates := unmatched[key]; len(candidates) > 0 {
+			unmatched[key] = candidates[1:]
+			matched[candidates[0]] = true
+			diffValues(itemPath, a.Index(candidates[0]), b.Index(i), changes)
+			continue
+		}
+		*changes = append(*changes, Change{itemPath, nil, significant(b.Index(i))})
+	}
+	for i := 0; i < a.Len(); i++ {
+		if !matched[i] {
+			*changes = append(*changes, Change{fmt.Sprintf("%s[%d]", path, i), significant(a.Index(i)), nil})
+		}
+	}
+}
+
+// skipped сообщает, что поле не сравнивается: неэкспортируемое, gorm.Model или с тегом diff:"-"
+func skipped(field reflect.StructField) bool {
+	return !field.IsExported() || field.Type == modelType || field.Tag.Get("diff") == "-"
+}
+
+// significant возвращает значение добавленной или удаленной записи без несравниваемых полей
+func significant(v reflect.Value) interface{} {
+	if v.Kind() != reflect.Struct {
+		return v.Interface()
+	}
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	for i := 0; i < copied.NumField(); i++ {
+		if field := copied.Type().Field(i); field.IsExported() && skipped(field) {
+			copied.Field(i).Set(reflect.Zero(field.Type))
+		}
+	}
+	return copied.Interface()
+}
+
+// fieldName возвращает JSON-имя поля, а если его нет - имя поля в Go
+func fieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+	created := time.Date(2021, 11, 26, 6, 22, 19, 123456789, time.UTC)
+	old := Order{
+		OrderUID:    "a",
+		DateCreated: created,
+		Delivery:    Delivery{City: "Kazan"},
+		Items:       []Items{{ChrtID: 1, Status: 1}},
+	}
+	assert.Empty(Diff(old, old))
+
+	// Время из БД с точностью до микросекунды и в другом часовом поясе совпадает
+	same := old
+	same.DateCreated = created.Round(time.Microsecond).In(time.FixedZone("MSK", 3*60*60))
+	assert.Empty(Diff(old, same))
+
+	cancelled := created.Add(time.Hour)
+	changed := old
+	changed.ID = 7
+	changed.Delivery.City = "Moscow"
+	changed.Items = []Items{{ChrtID: 1, Status: 2}, {ChrtID: 2}}
+	changed.CancelledAt = &cancelled
+	assert.Equal([]Change{
+		{"delivery.City", "Kazan", "Moscow"},
+		{"items[0].Status", 1, 2},
+		{"items[1]", nil, Items{ChrtID: 2}},
+		{"CancelledAt", (*time.Time)(nil), &cancelled},
+	}, Diff(old, changed))
+}
+
+func TestDiffIgnoresStorageFields(t *testing.T) {
+	assert := assert.New(t)
+	old := Order{
+		OrderUID: "a",
+		Delivery: Delivery{Model: gorm.Model{ID: 1}, City: "Kazan", OrderUID: "a"},
+		Items: []Items{
+			{Model: gorm.Model{ID: 10}, ChrtID: 1, RID: "r1", OrderUID: "a"},
+			{Model: gorm.Model{ID: 11}, ChrtID: 2, RID: "r2", OrderUID: "a"},
+			{Model: gorm.Model{ID: 12}, ChrtID: 3, RID: "r3", OrderUID: "a"},
+		},
+	}
+	// Замена заказа создает позиции заново с новыми id и временем, порядок может измениться
+	now := time.Now()
+	replaced := Order{
+		Model:    gorm.Model{ID: 5, CreatedAt: now, UpdatedAt: now},
+		OrderUID: "a",
+		Delivery: Delivery{Model: gorm.Model{ID: 1, UpdatedAt: now}, City: "Kazan"},
+		Items: []Items{
+			{Model: gorm.Model{ID: 21, CreatedAt: now}, ChrtID: 2, RID: "r2", OrderUID: "a", Status: 5},
+			{Model: gorm.Model{ID: 20, CreatedAt: now}, ChrtID: 1, RID: "r1", OrderUID: "a"},
+			{Model: gorm.Model{ID: 22, CreatedAt: now}, ChrtID: 4, RID: "r4", OrderUID: "a"},
+		},
+	}
+	assert.Equal([]Change{
+		{"items[0].Status", 0, 5},
+		{"items[2]", nil, Items{ChrtID: 4, RID: "r4"}},
+		{"items[2]", Items{ChrtID: 3, RID: "r3"}, nil},
+	}, Diff(old, replaced))
+}
@@ -0,0 +1,25 @@
+package models
+
+// Типы событий заказа в канале
+const (
+	EventCreated           = "created"
+	EventUpdated           = "updated"
+	EventCancelled         = "cancelled"
+	EventItemStatusChanged = "item_status_changed"
+)
+
+// OrderEvent событие изменения заказа. Версия растет с каждым событием заказа,
+// события с версией не новее сохраненной отбрасываются.
+type OrderEvent struct {
+	Type     string            `json:"Type"`
+	OrderUID string            `json:"OrderUID"`
+	Version  int               `json:"Version"`
+	Order    *Order            `json:"Order,omitempty"` // Новое состояние заказа для created и updated
+	Item     *ItemStatusChange `json:"Item,omitempty"`  // Для item_status_changed
+}
+
+// ItemStatusChange новый статус позиции заказа
+type ItemStatusChange struct {
+	ChrtID int `json:"Chrt_id"`
+	Status int `json:"Status"`
+}
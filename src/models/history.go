@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OrderHistory запись журнала изменений заказа. Записи только добавляются: документы заказа
+// до и после изменения хранятся целиком, для создания нет Previous, для удаления - Current.
+type OrderHistory struct {
+	ID        uint      `gorm:"primaryKey" json:"ID"`
+	OrderUID  string    `gorm:"index;not null" json:"OrderUID"`
+	Source    string    `json:"Source"`                     // Откуда пришло изменение: nats:<номер сообщения> или http:<id запроса>
+	Previous  *string   `gorm:"type:jsonb" json:"Previous"` // Заказ до изменения в JSON
+	Current   *string   `gorm:"type:jsonb" json:"Current"`  // Заказ после изменения в JSON
+	CreatedAt time.Time `gorm:"index" json:"CreatedAt"`
+}
+
+func (OrderHistory) TableName() string {
+	return "order_history"
+}
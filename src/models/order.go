@@ -5,64 +5,67 @@ import (
 	"time"
 )
 
-// todo надо посмотреть как выставить ограничения not null uniq и тд будет проще тестировать
+// Order заказ. Доставка, оплата и позиции ссылаются на него по OrderUID и удаляются вместе с ним.
+// Ограничения схемы описаны в тегах и в миграциях src/migrations, они должны совпадать.
 type Order struct {
 	gorm.Model
-	OrderUID          string   `gorm:"uniqueIndex" json:"OrderUID"` // PK
-	TrackNumber       string   `json:"TrackNumber"`
-	Entry             string   `json:"Entry"`
-	Delivery          Delivery `json:"delivery"`
-	Payment           Payment  `json:"payment"`
-	Items             []Items  `json:"items"`
-	Locale            string   `json:"Locale"`
-	InternalSignature string   `json:"InternalSignature"`
-	CustomerID        string   `json:"CustomerID"`
-	DeliveryService   string   `json:"DeliveryService"`
-	Shardkey          string   `json:"Shardkey"`
-	SmID              string   `json:"SmID"`
-	DateCreated       time.Time
-	OofShard          string `json:"OofShard"`
+	OrderUID          string     `gorm:"uniqueIndex;not null;check:order_uid <> ''" json:"OrderUID"` // PK
+	TrackNumber       string     `gorm:"index;not null" json:"TrackNumber"`
+	Entry             string     `json:"Entry"`
+	Delivery          Delivery   `gorm:"foreignKey:OrderUID;references:OrderUID;constraint:OnDelete:CASCADE" json:"delivery"`
+	Payment           Payment    `gorm:"foreignKey:OrderUID;references:OrderUID;constraint:OnDelete:CASCADE" json:"payment"`
+	Items             []Items    `gorm:"foreignKey:OrderUID;references:OrderUID;constraint:OnDelete:CASCADE" json:"items"`
+	Locale            string     `json:"Locale"`
+	InternalSignature string     `json:"InternalSignature"`
+	CustomerID        string     `gorm:"index" json:"CustomerID"`
+	DeliveryService   string     `json:"DeliveryService"`
+	Shardkey          string     `json:"Shardkey"`
+	SmID              string     `json:"SmID"`
+	DateCreated       time.Time  `gorm:"index"`
+	OofShard          string     `json:"OofShard"`
+	Version           int        `gorm:"not null" json:"Version"` // Версия последнего примененного события
+	CancelledAt       *time.Time `json:"CancelledAt,omitempty"`   // Время отмены заказа
 }
 
 type Delivery struct {
 	gorm.Model
-	Name    string `json:"Name"`
-	Phone   string `json:"Phone"`
-	Zip     string `json:"Zip"`
-	City    string `json:"City"`
-	Adress  string `json:"Adress"`
-	Region  string `json:"Region"`
-	Email   string `json:"Email"`
-	OrderID uint
+	Name     string `json:"Name"`
+	Phone    string `json:"Phone"`
+	Zip      string `json:"Zip"`
+	City     string `json:"City"`
+	Adress   string `json:"Adress"`
+	Region   string `json:"Region"`
+	Email    string `json:"Email"`
+	OrderUID string `gorm:"uniqueIndex;not null" diff:"-"` // Связь с Order, у заказа одна доставка
 }
 
 type Payment struct {
 	gorm.Model
-	Transaction  string `json:"Transaction"`
+	Transaction  string `gorm:"uniqueIndex:idx_payments_transaction,where:\"transaction\" <> ''" json:"Transaction"` // Пустая транзакция не уникальна
 	RequestID    string `json:"RequestID"`
 	Currency     string `json:"Currency"`
 	Provider     string `json:"Provider"`
-	Amount       int    `json:"Amount"`
+	Amount       int    `gorm:"not null;check:amount >= 0" json:"Amount"`
 	PaymentDt    int    `json:"PaymentDt"`
 	Bank         string `json:"Bank"`
-	DeliveryCost int    `json:"DeliveryCost"`
-	GoodsTotal   int    `json:"GoodsTotal"`
-	CustomFee    int    `json:"CustomFee"`
-	OrderID      uint   // Связь с Order
+	DeliveryCost int    `gorm:"not null;check:delivery_cost >= 0" json:"DeliveryCost"`
+	GoodsTotal   int    `gorm:"not null;check:goods_total >= 0" json:"GoodsTotal"`
+	CustomFee    int    `gorm:"not null;check:custom_fee >= 0" json:"CustomFee"`
+	OrderUID     string `gorm:"uniqueIndex;not null" diff:"-"` // Связь с Order, у заказа одна оплата
 }
 
 type Items struct {
 	gorm.Model
-	ChrtID      int    `json:"Chrt_id"`
+	ChrtID      int    `gorm:"index;not null" json:"Chrt_id"`
 	TrackNumber string `json:"Track_number"`
-	Price       int    `json:"Price"`
-	RID         string `json:"RID"`
+	Price       int    `gorm:"not null;check:price >= 0" json:"Price"`
+	RID         string `gorm:"index;not null" json:"RID"`
 	Name        string `json:"Name"`
-	Sale        int    `json:"Sale"`
+	Sale        int    `gorm:"not null;check:sale >= 0 AND sale <= 100" json:"Sale"` // Скидка в процентах
 	Size        string `json:"Size"`
-	TotalPrice  int    `json:"TotalPrice"`
+	TotalPrice  int    `gorm:"not null;check:total_price >= 0" json:"TotalPrice"`
 	NmID        int    `json:"NmID"`
 	Brand       string `json:"Brand"`
 	Status      int    `json:"Status"`
-	OrderID     uint   // Связь с Order
+	OrderUID    string `gorm:"index;not null" diff:"-"` // Связь с Order
 }
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// QuarantinedMessage сообщение из NATS, которое не удалось обработать
+type QuarantinedMessage struct {
+	gorm.Model
+	Channel         string `gorm:"index" json:"Channel"` // Канал, из которого пришло сообщение
+	Data            []byte `json:"Data"`                 // Исходные байты сообщения
+	Sequence        uint64 `json:"Sequence"`
+	RedeliveryCount uint32 `json:"RedeliveryCount"`
+	Reason          string `json:"Reason"` // Причина, по которой сообщение попало в карантин
+}
@@ -32,6 +32,111 @@ var (
 		},
 		[]string{"path"},
 	)
+	IngestQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingest_queue_depth",
+			Help: "Количество сообщений в очередях пула обработчиков.",
+		},
+	)
+	IngestProcessingTime = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name: "ingest_processing_time_seconds",
+			Help: "Гистограмма времени обработки сообщения с заказом.",
+		},
+	)
+	IngestBatchSize = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "ingest_batch_size",
+			Help:    "Гистограмма размера пачек заказов, записываемых в БД.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		},
+	)
+	CacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "order_cache_hits_total",
+			Help: "Количество запросов, для которых заказ найден в кэше.",
+		},
+	)
+	CacheMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "order_cache_misses_total",
+			Help: "Количество запросов, для которых заказа нет в кэше.",
+		},
+	)
+	CacheEvictions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "order_cache_evictions_total",
+			Help: "Количество заказов, вытесненных из кэша, по причине (size, memory, ttl).",
+		},
+		[]string{"reason"},
+	)
+	CacheEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "order_cache_entries",
+			Help: "Количество заказов в кэше.",
+		},
+	)
+	CacheBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "order_cache_bytes",
+			Help: "Оценка памяти, занятой заказами в кэше.",
+		},
+	)
+	OrderLoadsCoalesced = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "order_db_loads_coalesced_total",
+			Help: "Количество запросов, которые дождались загрузки того же заказа из БД другим запросом.",
+		},
+	)
+	NegativeCacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "order_negative_cache_hits_total",
+			Help: "Количество запросов, получивших 404 по отметке об отсутствии заказа без обращения к БД.",
+		},
+	)
+	NegativeCacheMarks = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "order_negative_cache_marks_total",
+			Help: "Количество отметок об отсутствии заказа в БД.",
+		},
+	)
+	AuditChecked = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "order_cache_audit_checked_total",
+			Help: "Количество заказов кэша, сверенных с БД.",
+		},
+	)
+	AuditDivergences = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "order_cache_audit_divergences_total",
+			Help: "Количество расхождений кэша с БД по виду (stale, missing_in_db).",
+		},
+		[]string{"kind"},
+	)
+	AuditRepaired = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "order_cache_audit_repaired_total",
+			Help: "Количество исправленных расхождений кэша с БД.",
+		},
+	)
+	AuditLastDivergences = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "order_cache_audit_last_divergences",
+			Help: "Количество расхождений, найденных последней проверкой кэша.",
+		},
+	)
+	AuditLastRun = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "order_cache_audit_last_run_timestamp_seconds",
+			Help: "Время завершения последней проверки кэша.",
+		},
+	)
+	BrokerConnected = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "broker_connected",
+			Help: "Состояние соединения с брокером сообщений (1 - подключен, 0 - нет).",
+		},
+	)
 )
 
 func init() {
@@ -40,4 +145,21 @@ func init() {
 	prometheus.MustRegister(CacheResponseTime)
 	prometheus.MustRegister(DbResponseTime)
 	prometheus.MustRegister(OverallResponseTime)
+	prometheus.MustRegister(BrokerConnected)
+	prometheus.MustRegister(IngestQueueDepth)
+	prometheus.MustRegister(IngestProcessingTime)
+	prometheus.MustRegister(IngestBatchSize)
+	prometheus.MustRegister(CacheHits)
+	prometheus.MustRegister(CacheMisses)
+	prometheus.MustRegister(CacheEvictions)
+	prometheus.MustRegister(CacheEntries)
+	prometheus.MustRegister(CacheBytes)
+	prometheus.MustRegister(OrderLoadsCoalesced)
+	prometheus.MustRegister(NegativeCacheHits)
+	prometheus.MustRegister(NegativeCacheMarks)
+	prometheus.MustRegister(AuditChecked)
+	prometheus.MustRegister(AuditDivergences)
+	prometheus.MustRegister(AuditRepaired)
+	prometheus.MustRegister(AuditLastDivergences)
+	prometheus.MustRegister(AuditLastRun)
 }
@@ -0,0 +1,183 @@
+package natsclient
+
+import (
+	"fmt"
+	"time"
+)
+
+// Поддерживаемые реализации брокера
+const (
+	BackendSTAN      = "stan"
+	BackendJetStream = "jetstream"
+	BackendMemory    = "memory"   // Брокер в памяти процесса, для тестов и локального запуска
+	BackendEmbedded  = "embedded" // Встроенный nats-streaming-server
+)
+
+const (
+	defaultDurableName = "my-durable"
+	defaultAckWait     = 30 * time.Second
+)
+
+// Message сообщение брокера, не зависящее от реализации
+type Message struct {
+	Subject         string
+	Data            []byte
+	Sequence        uint64 // Порядковый номер сообщения в канале
+	RedeliveryCount uint32 // Сколько раз сообщение уже доставлялось повторно
+	Timestamp       time.Time
+	ack             func() error
+}
+
+// Ack подтверждает сообщение. Нужен только для подписок с AsyncAck, остальные подтверждаются брокером.
+func (m *Message) Ack() error {
+	if m.ack == nil {
+		return nil
+	}
+	return m.ack()
+}
+
+// Handler обрабатывает сообщение в режиме ручного подтверждения.
+// Сообщение подтверждается только если обработчик вернул nil, иначе оно будет доставлено повторно по истечении AckWait.
+type Handler func(m *Message) error
+
+// SubscribeOptions параметры подписки
+type SubscribeOptions struct {
+	DurableName string // Пустое имя означает подписку без сохранения позиции
+	QueueGroup  string // Если задана, сообщения распределяются между всеми подписчиками группы
+	AckWait     time.Duration
+	MaxInflight int  // Максимум доставленных, но не подтвержденных сообщений, 0 - значение брокера по умолчанию
+	AsyncAck    bool // Обработчик сам вызывает Message.Ack, результат обработчика не влияет на подтверждение
+	// Начальная позиция новой подписки, по умолчанию используется поведение брокера
+	StartSequence uint64
+	StartTime     time.Time
+	DeliverAll    bool
+	NewOnly       bool
+}
+
+// SubscribeOption изменяет параметры подписки
+type SubscribeOption func(*SubscribeOptions)
+
+// DurableName задает имя durable подписки
+func DurableName(name string) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.DurableName = name
+	}
+}
+
+// NonDurable создает подписку без durable имени, позиция не сохраняется после отписки
+func NonDurable() SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.DurableName = ""
+	}
+}
+
+// StartAtSequence начинает доставку с сообщения с указанным порядковым номером
+func StartAtSequence(seq uint64) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.StartSequence = seq
+	}
+}
+
+// StartAtTime начинает доставку с первого сообщения, опубликованного не раньше t
+func StartAtTime(t time.Time) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.StartTime = t
+	}
+}
+
+// DeliverAllAvailable начинает доставку с самого первого сообщения в теме
+func DeliverAllAvailable() SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.DeliverAll = true
+	}
+}
+
+// DeliverNewOnly доставляет только сообщения, опубликованные после подписки
+func DeliverNewOnly() SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.NewOnly = true
+	}
+}
+
+// QueueGroup задает очередь, участники которой делят между собой сообщения темы.
+// Пустое имя означает обычную подписку, которая получает все сообщения.
+func QueueGroup(name string) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.QueueGroup = name
+	}
+}
+
+// AckWait задает время ожидания подтверждения до повторной доставки
+func AckWait(d time.Duration) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.AckWait = d
+	}
+}
+
+// MaxInflight ограничивает количество доставленных, но еще не подтвержденных сообщений
+func MaxInflight(n int) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.MaxInflight = n
+	}
+}
+
+// AsyncAck передает подтверждение сообщений обработчику: он может вернуть управление сразу,
+// а вызвать Message.Ack позже из другой горутины
+func AsyncAck() SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.AsyncAck = true
+	}
+}
+
+// newSubscribeOptions возвращает параметры подписки с примененными опциями
+func newSubscribeOptions(opts []SubscribeOption) SubscribeOptions {
+	o := SubscribeOptions{
+		DurableName: defaultDurableName,
+		AckWait:     defaultAckWait,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Broker общий интерфейс для реализаций брокера сообщений
+type Broker interface {
+	// Subscribe подписывается на тему, сообщения подтверждаются после успешной обработки
+	Subscribe(topic string, handler Handler, opts ...SubscribeOption) error
+	// Unsubscribe отписывается от темы
+	Unsubscribe(topic string) error
+	// PublishMessage публикует сообщение в тему
+	PublishMessage(topic string, message []byte) error
+	// IsConnected сообщает, установлено ли соединение с брокером
+	IsConnected() bool
+	// Close закрывает соединение с брокером
+	Close() error
+}
+
+// BrokerConfig параметры подключения к брокеру
+type BrokerConfig struct {
+	Backend   string // stan, jetstream, memory или embedded
+	URL       string
+	ClusterID string // Используется только NATS Streaming и встроенным сервером
+	ClientID  string // Используется только NATS Streaming и встроенным сервером
+	Stream    string // Имя потока JetStream
+	// Темы событий, которые не нужно хранить: JetStream публикует их через core NATS мимо потока
+	TransientSubjects []string
+}
+
+// NewBroker создает брокер выбранной в конфигурации реализации
+func NewBroker(cfg BrokerConfig) (Broker, error) {
+	switch cfg.Backend {
+	case BackendSTAN, "":
+		return NewNatsClient(cfg.URL, cfg.ClusterID, cfg.ClientID)
+	case BackendJetStream:
+		return NewJetStreamClient(cfg.URL, cfg.Stream, cfg.TransientSubjects...)
+	case BackendMemory:
+		return NewMemoryBroker(), nil
+	case BackendEmbedded:
+		return NewEmbeddedClient(cfg.ClusterID, cfg.ClientID)
+	default:
+		return nil, fmt.Errorf("неизвестный брокер: %s", cfg.Backend)
+	}
+}
@@ -0,0 +1,44 @@
+package natsclient
+
+import (
+	stand "github.com/nats-io/nats-streaming-server/server"
+)
+
+// EmbeddedClient NatsClient, подключенный к встроенному в процесс nats-streaming-server
+type EmbeddedClient struct {
+	*NatsClient
+	server *stand.StanServer
+}
+
+// StartEmbeddedServer запускает nats-streaming-server с хранением в памяти на свободном порту
+func StartEmbeddedServer(clusterID string) (*stand.StanServer, error) {
+	stanOpts := stand.GetDefaultOptions()
+	stanOpts.ID = clusterID
+
+	natsOpts := stand.DefaultNatsServerOptions
+	natsOpts.Port = -1 // Случайный свободный порт
+
+	return stand.RunServerWithOpts(stanOpts, &natsOpts)
+}
+
+// NewEmbeddedClient запускает встроенный nats-streaming-server и подключается к нему
+func NewEmbeddedClient(clusterID string, clientID string) (*EmbeddedClient, error) {
+	srv, err := StartEmbeddedServer(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewNatsClient(srv.ClientURL(), clusterID, clientID)
+	if err != nil {
+		srv.Shutdown()
+		return nil, err
+	}
+	return &EmbeddedClient{NatsClient: client, server: srv}, nil
+}
+
+// Close закрывает соединение и останавливает встроенный сервер
+func (c *EmbeddedClient) Close() error {
+	err := c.NatsClient.Close()
+	c.server.Shutdown()
+	return err
+}
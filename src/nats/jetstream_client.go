@@ -0,0 +1,301 @@
+package natsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"wild_project/src/my_prometheus"
+)
+
+const (
+	requestTimeout             = 5 * time.Second
+	ephemeralInactiveThreshold = time.Minute
+)
+
+// JetStreamClient реализация Broker поверх NATS JetStream с durable pull консьюмерами.
+// Темы из transient публикуются через core NATS мимо потока: их сообщения нужны только
+// подписчикам, которые подключены в момент публикации, и хранить их незачем.
+type JetStreamClient struct {
+	nc        *nats.Conn
+	js        jetstream.JetStream
+	stream    string
+	transient map[string]bool
+	subs      map[string]jetstream.ConsumeContext
+	coreSubs  map[string]*nats.Subscription
+	mu        sync.Mutex
+	logger    *log.Logger
+}
+
+// NewJetStreamClient подключается к NATS и создает поток stream, если его еще нет.
+// Темы transient не добавляются в поток.
+func NewJetStreamClient(url string, stream string, transient ...string) (*JetStreamClient, error) {
+	logger := log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	// Клиент nats.go сам переподключается, а pull консьюмеры продолжают получать сообщения после восстановления
+	nc, err := nats.Connect(url,
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, reason error) {
+			logger.Printf("Соединение потеряно, причина: %v", reason)
+			my_prometheus.BrokerConnected.Set(0)
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			logger.Println("Соединение восстановлено")
+			my_prometheus.BrokerConnected.Set(1)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	my_prometheus.BrokerConnected.Set(1)
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	client := &JetStreamClient{
+		nc:        nc,
+		js:        js,
+		stream:    stream,
+		transient: make(map[string]bool, len(transient)),
+		subs:      make(map[string]jetstream.ConsumeContext),
+		coreSubs:  make(map[string]*nats.Subscription),
+		logger:    logger,
+	}
+	for _, topic := range transient {
+		client.transient[topic] = true
+	}
+	return client, nil
+}
+
+// ensureSubject создает поток или добавляет в него тему, если она еще не покрыта потоком
+func (c *JetStreamClient) ensureSubject(ctx context.Context, topic string) error {
+	s, err := c.js.Stream(ctx, c.stream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		_, err = c.js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     c.stream,
+			Subjects: []string{topic},
+			Storage:  jetstream.FileStorage,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg := s.CachedInfo().Config
+	for _, subject := range cfg.Subjects {
+		if subject == topic {
+			return nil
+		}
+	}
+	cfg.Subjects = append(cfg.Subjects, topic)
+	_, err = c.js.UpdateStream(ctx, cfg)
+	return err
+}
+
+// consumerName возвращает имя консьюмера, durable имена в JetStream общие для всего потока.
+// Все подписчики одного консьюмера делят его сообщения, поэтому очередь задается через имя.
+func consumerName(o SubscribeOptions, topic string) string {
+	name := fmt.Sprintf("%s-%s", o.DurableName, topic)
+	if o.QueueGroup != "" {
+		name = fmt.Sprintf("%s-%s-%s", o.QueueGroup, o.DurableName, topic)
+	}
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(name)
+}
+
+// Subscribe создает durable pull консьюмер на тему и подтверждает сообщения после успешной обработки
+func (c *JetStreamClient) Subscribe(topic string, handler Handler, opts ...SubscribeOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.subs[topic]; exists {
+		c.logger.Printf("Уже подписаны на тему: %s", topic)
+		return nil
+	}
+	if _, exists := c.coreSubs[topic]; exists {
+		c.logger.Printf("Уже подписаны на тему: %s", topic)
+		return nil
+	}
+	if c.transient[topic] {
+		return c.subscribeCore(topic, handler)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if err := c.ensureSubject(ctx, topic); err != nil {
+		c.logger.Printf("Не удалось подготовить поток для темы %s: %v", topic, err)
+		return err
+	}
+
+	o := newSubscribeOptions(opts)
+	consCfg := jetstream.ConsumerConfig{
+		FilterSubject: topic,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       o.AckWait,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		MaxAckPending: o.MaxInflight,
+	}
+	if o.DurableName != "" {
+		consCfg.Durable = consumerName(o, topic)
+	} else {
+		// Эфемерный консьюмер удаляется сервером, когда подписчик пропадает
+		consCfg.InactiveThreshold = ephemeralInactiveThreshold
+	}
+	switch {
+	case o.StartSequence > 0:
+		consCfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		consCfg.OptStartSeq = o.StartSequence
+	case !o.StartTime.IsZero():
+		startTime := o.StartTime
+		consCfg.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		consCfg.OptStartTime = &startTime
+	case o.NewOnly:
+		consCfg.DeliverPolicy = jetstream.DeliverNewPolicy
+	}
+	cons, err := c.js.CreateOrUpdateConsumer(ctx, c.stream, consCfg)
+	if err != nil {
+		c.logger.Printf("Не удалось создать консьюмер для темы %s: %v", topic, err)
+		return err
+	}
+
+	cc, err := cons.Consume(func(m jetstream.Msg) {
+		msg := &Message{
+			Subject: m.Subject(),
+			Data:    m.Data(),
+			ack:     m.Ack,
+		}
+		if meta, err := m.Metadata(); err == nil {
+			msg.Sequence = meta.Sequence.Stream
+			msg.RedeliveryCount = uint32(meta.NumDelivered - 1)
+			msg.Timestamp = meta.Timestamp
+		}
+		err := handler(msg)
+		if o.AsyncAck {
+			if err != nil {
+				c.logger.Printf("Ошибка обработки сообщения %d из темы %s: %v", msg.Sequence, topic, err)
+			}
+			return
+		}
+		if err != nil {
+			// Не подтверждаем сообщение, сервер доставит его повторно после AckWait
+			c.logger.Printf("Сообщение %d из темы %s не подтверждено: %v", msg.Sequence, topic, err)
+			return
+		}
+		if err := m.Ack(); err != nil {
+			c.logger.Printf("Ошибка подтверждения сообщения %d из темы %s: %v", msg.Sequence, topic, err)
+		}
+	})
+	if err != nil {
+		c.logger.Printf("Не удалось подписаться на тему %s: %v", topic, err)
+		return err
+	}
+
+	c.subs[topic] = cc
+	c.logger.Printf("Subscribed to topic: %s", topic)
+	return nil
+}
+
+// subscribeCore подписывается на тему через core NATS. Подтверждений и повторной доставки нет,
+// ошибка обработчика только логируется. Вызывается под мьютексом.
+func (c *JetStreamClient) subscribeCore(topic string, handler Handler) error {
+	sub, err := c.nc.Subscribe(topic, func(m *nats.Msg) {
+		msg := &Message{Subject: m.Subject, Data: m.Data, Timestamp: time.Now()}
+		if err := handler(msg); err != nil {
+			c.logger.Printf("Ошибка обработки сообщения из темы %s: %v", topic, err)
+		}
+	})
+	if err != nil {
+		c.logger.Printf("Не удалось подписаться на тему %s: %v", topic, err)
+		return err
+	}
+	c.coreSubs[topic] = sub
+	c.logger.Printf("Subscribed to topic: %s", topic)
+	return nil
+}
+
+// Unsubscribe останавливает получение сообщений из темы, durable консьюмер сохраняется на сервере
+func (c *JetStreamClient) Unsubscribe(topic string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if sub, ok := c.coreSubs[topic]; ok {
+		delete(c.coreSubs, topic)
+		c.logger.Printf("Unsubscribed from topic: %s", topic)
+		return sub.Unsubscribe()
+	}
+	cc, ok := c.subs[topic]
+	if !ok {
+		errorMessage := fmt.Sprintf("Подписка не найдена для темы: %s", topic)
+		c.logger.Println(errorMessage)
+		return errors.New(errorMessage)
+	}
+
+	cc.Stop()
+	delete(c.subs, topic)
+	c.logger.Printf("Unsubscribed from topic: %s", topic)
+	return nil
+}
+
+// PublishMessage публикует сообщение в тему и ждет подтверждения сохранения в потоке.
+// Сообщения тем transient публикуются без сохранения.
+func (c *JetStreamClient) PublishMessage(topic string, message []byte) error {
+	if c.transient[topic] {
+		if err := c.nc.Publish(topic, message); err != nil {
+			c.logger.Printf("Ошибка публикации сообщения %s: %v", topic, err)
+			return err
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	_, err := c.js.Publish(ctx, topic, message)
+	if errors.Is(err, jetstream.ErrNoStreamResponse) {
+		// Тема еще не входит в поток, добавляем ее и повторяем публикацию
+		if err = c.ensureSubject(ctx, topic); err == nil {
+			_, err = c.js.Publish(ctx, topic, message)
+		}
+	}
+	if err != nil {
+		c.logger.Printf("Ошибка публикации сообщения %s: %v", topic, err)
+		return err
+	}
+	c.logger.Printf("Сообщение опубликовано в тему: %s", topic)
+	return nil
+}
+
+// IsConnected сообщает, установлено ли соединение с NATS
+func (c *JetStreamClient) IsConnected() bool {
+	return c.nc.IsConnected()
+}
+
+// Close останавливает все подписки и закрывает соединение с NATS
+func (c *JetStreamClient) Close() error {
+	c.mu.Lock()
+	for topic, cc := range c.subs {
+		cc.Stop()
+		delete(c.subs, topic)
+	}
+	for topic, sub := range c.coreSubs {
+		sub.Unsubscribe()
+		delete(c.coreSubs, topic)
+	}
+	c.mu.Unlock()
+
+	if err := c.nc.Drain(); err != nil {
+		return err
+	}
+	c.logger.Println("Соединение успешно закрыто")
+	return nil
+}
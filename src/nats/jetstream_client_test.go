@@ -0,0 +1,102 @@
+package natsclient
+
+import (
+	"context"
+	"errors"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// runJetStreamServer запускает встроенный nats-server с включенным JetStream
+func runJetStreamServer(t *testing.T) *server.Server {
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("Не удалось создать nats-server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats-server не запустился")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func TestJetStreamClientRedeliversUnackedMessages(t *testing.T) {
+	assert := assert.New(t)
+	srv := runJetStreamServer(t)
+
+	client, err := NewBroker(BrokerConfig{Backend: BackendJetStream, URL: srv.ClientURL(), Stream: "ORDERS"})
+	if err != nil {
+		t.Fatalf("Не удалось подключиться к JetStream: %v", err)
+	}
+	defer client.Close()
+
+	received := make(chan *Message, 2)
+	err = client.Subscribe("orders", func(m *Message) error {
+		received <- m
+		if m.RedeliveryCount == 0 {
+			return errors.New("временная ошибка")
+		}
+		return nil
+	}, AckWait(200*time.Millisecond))
+	assert.NoError(err)
+
+	assert.NoError(client.PublishMessage("orders", []byte("order-1")))
+
+	for i := uint32(0); i < 2; i++ {
+		select {
+		case m := <-received:
+			assert.Equal("order-1", string(m.Data))
+			assert.Equal(uint64(1), m.Sequence)
+			assert.Equal(i, m.RedeliveryCount)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Сообщение не было доставлено (доставка %d)", i)
+		}
+	}
+}
+
+func TestJetStreamClientTransientSubject(t *testing.T) {
+	assert := assert.New(t)
+	srv := runJetStreamServer(t)
+
+	client, err := NewBroker(BrokerConfig{
+		Backend:           BackendJetStream,
+		URL:               srv.ClientURL(),
+		Stream:            "ORDERS",
+		TransientSubjects: []string{"cache-events"},
+	})
+	if err != nil {
+		t.Fatalf("Не удалось подключиться к JetStream: %v", err)
+	}
+	defer client.Close()
+
+	received := make(chan *Message, 1)
+	assert.NoError(client.Subscribe("orders", func(m *Message) error { return nil }))
+	assert.NoError(client.Subscribe("cache-events", func(m *Message) error {
+		received <- m
+		return nil
+	}, NonDurable(), DeliverNewOnly()))
+	assert.NoError(client.PublishMessage("cache-events", []byte("event")))
+
+	select {
+	case m := <-received:
+		assert.Equal("event", string(m.Data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Событие не было доставлено")
+	}
+
+	// Тема событий не попадает в поток с заказами
+	js := client.(*JetStreamClient).js
+	stream, err := js.Stream(context.Background(), "ORDERS")
+	assert.NoError(err)
+	assert.Equal([]string{"orders"}, stream.CachedInfo().Config.Subjects)
+	assert.Equal(uint64(0), stream.CachedInfo().State.Msgs)
+	assert.NoError(client.Unsubscribe("cache-events"))
+}
@@ -0,0 +1,292 @@
+package natsclient
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// idleWait время ожидания подписки, если нет ни новых сообщений, ни запланированных повторных доставок
+const idleWait = time.Hour
+
+// MemoryBroker реализация Broker в памяти процесса для тестов и локального запуска.
+// Повторяет контракт NatsClient: порядковые номера сообщений, durable подписки и повторная доставка после AckWait.
+type MemoryBroker struct {
+	mu       sync.Mutex
+	topics   map[string][]Message
+	durables map[string]*durableState
+	subs     map[string]*memorySubscription
+	logger   *log.Logger
+}
+
+// durableState позиция подписки, для durable подписок переживает Unsubscribe и повторную подписку с тем же именем
+type durableState struct {
+	next    uint64               // Следующий порядковый номер для первой доставки
+	pending map[uint64]*inflight // Доставленные, но не подтвержденные сообщения
+}
+
+// inflight неподтвержденное сообщение, которое будет доставлено повторно после due
+type inflight struct {
+	count uint32 // Номер последней повторной доставки
+	due   time.Time
+}
+
+// memorySubscription подписка MemoryBroker, сообщения доставляются последовательно в отдельной горутине
+type memorySubscription struct {
+	topic   string
+	handler Handler
+	opts    SubscribeOptions
+	state   *durableState
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewMemoryBroker создает новый пустой MemoryBroker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics:   make(map[string][]Message),
+		durables: make(map[string]*durableState),
+		subs:     make(map[string]*memorySubscription),
+		logger:   log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
+	}
+}
+
+// Subscribe подписывается на тему, доставка продолжается с позиции durable подписки
+func (b *MemoryBroker) Subscribe(topic string, handler Handler, opts ...SubscribeOption) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.subs[topic]; exists {
+		b.logger.Printf("Уже подписаны на тему: %s", topic)
+		return nil
+	}
+
+	o := newSubscribeOptions(opts)
+	var state *durableState
+	if o.DurableName != "" {
+		key := topic + "/" + o.QueueGroup + "/" + o.DurableName
+		state = b.durables[key]
+		if state == nil {
+			state = b.newState(topic, o)
+			b.durables[key] = state
+		}
+	} else {
+		state = b.newState(topic, o)
+	}
+
+	sub := &memorySubscription{
+		topic:   topic,
+		handler: handler,
+		opts:    o,
+		state:   state,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	b.subs[topic] = sub
+	go b.run(sub)
+
+	b.logger.Printf("Subscribed to topic: %s", topic)
+	return nil
+}
+
+// newState создает позицию новой подписки с учетом начальной позиции из опций.
+// По умолчанию, как в STAN, новая подписка получает только сообщения, опубликованные после нее.
+func (b *MemoryBroker) newState(topic string, o SubscribeOptions) *durableState {
+	state := &durableState{next: uint64(len(b.topics[topic]) + 1), pending: make(map[uint64]*inflight)}
+	switch {
+	case o.StartSequence > 0:
+		state.next = o.StartSequence
+	case !o.StartTime.IsZero():
+		msgs := b.topics[topic]
+		state.next = uint64(len(msgs) + 1)
+		for _, m := range msgs {
+			if !m.Timestamp.Before(o.StartTime) {
+				state.next = m.Sequence
+				break
+			}
+		}
+	case o.DeliverAll:
+		state.next = 1
+	}
+	return state
+}
+
+// run доставляет сообщения подписчику, пока подписка не будет остановлена
+func (b *MemoryBroker) run(sub *memorySubscription) {
+	defer close(sub.done)
+
+	for {
+		msg, wait, ok := b.nextDelivery(sub)
+		if ok {
+			b.deliver(sub, msg)
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-sub.stop:
+			timer.Stop()
+			return
+		case <-sub.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// nextDelivery возвращает следующее сообщение для доставки либо время, через которое стоит проверить снова
+func (b *MemoryBroker) nextDelivery(sub *memorySubscription) (Message, time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-sub.stop:
+		return Message{}, 0, false
+	default:
+	}
+
+	now := time.Now()
+	wait := idleWait
+	msgs := b.topics[sub.topic]
+	state := sub.state
+
+	// Сначала повторные доставки, срок которых истек, в порядке номеров
+	var dueSeq uint64
+	for seq, p := range state.pending {
+		if !p.due.After(now) {
+			if dueSeq == 0 || seq < dueSeq {
+				dueSeq = seq
+			}
+		} else if d := p.due.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if dueSeq != 0 {
+		p := state.pending[dueSeq]
+		p.count++
+		p.due = now.Add(sub.opts.AckWait)
+		msg := msgs[dueSeq-1]
+		msg.RedeliveryCount = p.count
+		msg.ack = b.ackFunc(state, dueSeq)
+		return msg, 0, true
+	}
+
+	inflightFull := sub.opts.MaxInflight > 0 && len(state.pending) >= sub.opts.MaxInflight
+	if state.next <= uint64(len(msgs)) && !inflightFull {
+		seq := state.next
+		state.next++
+		state.pending[seq] = &inflight{due: now.Add(sub.opts.AckWait)}
+		msg := msgs[seq-1]
+		msg.ack = b.ackFunc(state, seq)
+		return msg, 0, true
+	}
+	return Message{}, wait, false
+}
+
+// ackFunc возвращает функцию подтверждения сообщения seq
+func (b *MemoryBroker) ackFunc(state *durableState, seq uint64) func() error {
+	return func() error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(state.pending, seq)
+
+		// Освободилось место для новых сообщений
+		for _, sub := range b.subs {
+			if sub.state == state {
+				select {
+				case sub.wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// deliver вызывает обработчик и подтверждает сообщение, если обработка прошла успешно.
+// Неподтвержденное сообщение будет доставлено повторно после AckWait.
+func (b *MemoryBroker) deliver(sub *memorySubscription, msg Message) {
+	err := sub.handler(&msg)
+	if sub.opts.AsyncAck {
+		if err != nil {
+			b.logger.Printf("Ошибка обработки сообщения %d из темы %s: %v", msg.Sequence, sub.topic, err)
+		}
+		return
+	}
+	if err != nil {
+		b.logger.Printf("Сообщение %d из темы %s не подтверждено: %v", msg.Sequence, sub.topic, err)
+		return
+	}
+	msg.Ack()
+}
+
+// Unsubscribe останавливает подписку, позиция durable подписки сохраняется.
+// Нельзя вызывать из обработчика сообщений этой же подписки.
+func (b *MemoryBroker) Unsubscribe(topic string) error {
+	b.mu.Lock()
+	sub, ok := b.subs[topic]
+	if !ok {
+		b.mu.Unlock()
+		errorMessage := fmt.Sprintf("Подписка не найдена для темы: %s", topic)
+		b.logger.Println(errorMessage)
+		return errors.New(errorMessage)
+	}
+	delete(b.subs, topic)
+	close(sub.stop)
+	b.mu.Unlock()
+
+	<-sub.done
+	b.logger.Printf("Unsubscribed from topic: %s", topic)
+	return nil
+}
+
+// PublishMessage сохраняет сообщение в теме и будит подписчика
+func (b *MemoryBroker) PublishMessage(topic string, message []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := make([]byte, len(message))
+	copy(data, message)
+	msgs := b.topics[topic]
+	b.topics[topic] = append(msgs, Message{
+		Subject:   topic,
+		Data:      data,
+		Sequence:  uint64(len(msgs) + 1),
+		Timestamp: time.Now(),
+	})
+
+	if sub, ok := b.subs[topic]; ok {
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// IsConnected всегда true, брокер находится в памяти процесса
+func (b *MemoryBroker) IsConnected() bool {
+	return true
+}
+
+// Close останавливает все подписки
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	topics := make([]string, 0, len(b.subs))
+	for topic := range b.subs {
+		topics = append(topics, topic)
+	}
+	b.mu.Unlock()
+
+	for _, topic := range topics {
+		if err := b.Unsubscribe(topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
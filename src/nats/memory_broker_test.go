@@ -0,0 +1,109 @@
+package natsclient
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// receive ждет следующее сообщение из канала или завершает тест по таймауту
+func receive(t *testing.T, ch <-chan Message) Message {
+	t.Helper()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("Сообщение не было доставлено")
+		return Message{}
+	}
+}
+
+func TestMemoryBrokerRedelivery(t *testing.T) {
+	assert := assert.New(t)
+	b := NewMemoryBroker()
+	defer b.Close()
+
+	received := make(chan Message, 4)
+	err := b.Subscribe("orders", func(m *Message) error {
+		received <- *m
+		if m.RedeliveryCount < 2 {
+			return errors.New("временная ошибка")
+		}
+		return nil
+	}, AckWait(10*time.Millisecond))
+	assert.NoError(err)
+
+	assert.NoError(b.PublishMessage("orders", []byte("order-1")))
+
+	for i := uint32(0); i < 3; i++ {
+		m := receive(t, received)
+		assert.Equal("order-1", string(m.Data))
+		assert.Equal(uint64(1), m.Sequence)
+		assert.Equal(i, m.RedeliveryCount)
+	}
+
+	select {
+	case m := <-received:
+		t.Fatalf("Подтвержденное сообщение доставлено повторно: %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryBrokerDurableResume(t *testing.T) {
+	assert := assert.New(t)
+	b := NewMemoryBroker()
+	defer b.Close()
+
+	received := make(chan Message, 4)
+	handler := func(m *Message) error {
+		received <- *m
+		return nil
+	}
+
+	assert.NoError(b.Subscribe("orders", handler, DurableName("worker")))
+	assert.NoError(b.PublishMessage("orders", []byte("order-1")))
+	assert.Equal(uint64(1), receive(t, received).Sequence)
+	assert.NoError(b.Unsubscribe("orders"))
+
+	// Пока подписки нет, сообщения накапливаются в теме
+	assert.NoError(b.PublishMessage("orders", []byte("order-2")))
+	assert.NoError(b.PublishMessage("orders", []byte("order-3")))
+
+	assert.NoError(b.Subscribe("orders", handler, DurableName("worker")))
+	assert.Equal(uint64(2), receive(t, received).Sequence)
+	assert.Equal(uint64(3), receive(t, received).Sequence)
+	assert.NoError(b.Unsubscribe("orders"))
+
+	// Новое durable имя, как в STAN, получает только новые сообщения
+	assert.NoError(b.Subscribe("orders", handler, DurableName("other")))
+	assert.NoError(b.PublishMessage("orders", []byte("order-4")))
+	assert.Equal(uint64(4), receive(t, received).Sequence)
+	assert.NoError(b.Unsubscribe("orders"))
+
+	// С DeliverAllAvailable новое durable имя читает тему с начала
+	assert.NoError(b.Subscribe("orders", handler, DurableName("third"), DeliverAllAvailable()))
+	assert.Equal(uint64(1), receive(t, received).Sequence)
+}
+
+func TestEmbeddedClientPublishSubscribe(t *testing.T) {
+	assert := assert.New(t)
+
+	client, err := NewBroker(BrokerConfig{Backend: BackendEmbedded, ClusterID: "test-cluster", ClientID: "test-client"})
+	if err != nil {
+		t.Fatalf("Не удалось запустить встроенный сервер: %v", err)
+	}
+	defer client.Close()
+
+	received := make(chan Message, 1)
+	err = client.Subscribe("orders", func(m *Message) error {
+		received <- *m
+		return nil
+	})
+	assert.NoError(err)
+
+	assert.NoError(client.PublishMessage("orders", []byte("order-1")))
+	m := receive(t, received)
+	assert.Equal("order-1", string(m.Data))
+	assert.Equal(uint64(1), m.Sequence)
+}
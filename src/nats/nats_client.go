@@ -7,40 +7,208 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
+	"wild_project/src/my_prometheus"
 )
 
+// Параметры пингов сервера: соединение считается потерянным после pingMaxOut неотвеченных пингов.
+// Тесты уменьшают их, чтобы быстрее заметить остановку сервера.
+var (
+	pingInterval = 5 // секунд
+	pingMaxOut   = 3
+)
+
+const (
+	// Границы экспоненциальной задержки между попытками переподключения
+	minReconnectWait = time.Second
+	maxReconnectWait = 30 * time.Second
+)
+
+// subscription подписка и параметры, с которыми она создавалась, нужны для повторной подписки после переподключения
+type subscription struct {
+	sub     stan.Subscription
+	handler Handler
+	opts    []SubscribeOption
+}
+
 // NatsClient хранит экземпляр соединения, карту подписок и мьютекс для синхронизации
 type NatsClient struct {
-	nc     stan.Conn
-	subs   map[string]stan.Subscription
-	mu     sync.Mutex
-	logger *log.Logger
+	nc        stan.Conn
+	url       string
+	clusterID string
+	clientID  string
+	subs      map[string]*subscription
+	mu        sync.Mutex
+	connected bool
+	closed    bool
+	logger    *log.Logger
 }
 
 // NewNatsClient устанавливает новое соединение с сервером NATS Streaming и возвращает новый NatsClient
 func NewNatsClient(url string, clusterID string, clientID string) (*NatsClient, error) {
-	logger := log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	c := &NatsClient{
+		url:       url,
+		clusterID: clusterID,
+		clientID:  clientID,
+		subs:      make(map[string]*subscription),
+		logger:    log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
+	}
+
+	nc, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
 
-	nc, err := stan.Connect(clusterID, clientID, stan.NatsURL(url),
+	// Возвращение нового экземпляра NatsClient
+	c.nc = nc
+	c.setConnected(true)
+	return c, nil
+}
+
+// connect устанавливает соединение с сервером NATS Streaming
+func (c *NatsClient) connect() (stan.Conn, error) {
+	return stan.Connect(c.clusterID, c.clientID, stan.NatsURL(c.url),
+		stan.Pings(pingInterval, pingMaxOut),
 		stan.SetConnectionLostHandler(func(_ stan.Conn, reason error) {
-			logger.Println("Соединение потеряно, причина: %v", reason)
+			c.logger.Printf("Соединение потеряно, причина: %v", reason)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.setConnected(false)
+			if !c.closed {
+				go c.reconnect()
+			}
 		}),
 	)
+}
 
-	if err != nil {
-		return nil, err
+// setConnected обновляет состояние соединения и метрику, вызывается под мьютексом
+func (c *NatsClient) setConnected(connected bool) {
+	c.connected = connected
+	if connected {
+		my_prometheus.BrokerConnected.Set(1)
+	} else {
+		my_prometheus.BrokerConnected.Set(0)
 	}
+}
 
-	// Возвращение нового экземпляра NatsClient
-	return &NatsClient{
-		nc:     nc,
-		subs:   make(map[string]stan.Subscription),
-		logger: logger,
-	}, nil
+// nextReconnectWait удваивает задержку между попытками переподключения, не превышая maxReconnectWait
+func nextReconnectWait(wait time.Duration) time.Duration {
+	wait *= 2
+	if wait > maxReconnectWait {
+		return maxReconnectWait
+	}
+	return wait
+}
+
+// reconnect переподключается к серверу с экспоненциальной задержкой и восстанавливает все подписки с теми же durable именами
+func (c *NatsClient) reconnect() {
+	wait := minReconnectWait
+	for attempt := 1; ; attempt++ {
+		time.Sleep(wait)
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		nc, err := c.connect()
+		if err != nil {
+			c.logger.Printf("Попытка переподключения %d не удалась: %v", attempt, err)
+			wait = nextReconnectWait(wait)
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			nc.Close()
+			return
+		}
+		if err := c.resubscribe(nc); err != nil {
+			c.mu.Unlock()
+			c.logger.Printf("Не удалось восстановить подписки: %v", err)
+			nc.Close()
+			wait = nextReconnectWait(wait)
+			continue
+		}
+		c.nc = nc
+		c.setConnected(true)
+		c.mu.Unlock()
+
+		c.logger.Printf("Соединение восстановлено после %d попыток", attempt)
+		return
+	}
+}
+
+// resubscribe заново создает все сохраненные подписки на новом соединении, вызывается под мьютексом
+func (c *NatsClient) resubscribe(nc stan.Conn) error {
+	for topic, s := range c.subs {
+		sub, err := c.subscribe(nc, topic, s.handler, s.opts)
+		if err != nil {
+			return fmt.Errorf("тема %s: %w", topic, err)
+		}
+		s.sub = sub
+		c.logger.Printf("Подписка на тему %s восстановлена", topic)
+	}
+	return nil
 }
 
-// Subscribe подписывается на тему
-func (c *NatsClient) Subscribe(topic string, handler stan.MsgHandler) error {
+// subscribe создает подписку на соединении nc в режиме ручного подтверждения сообщений
+func (c *NatsClient) subscribe(nc stan.Conn, topic string, handler Handler, opts []SubscribeOption) (stan.Subscription, error) {
+	o := newSubscribeOptions(opts)
+	cb := func(m *stan.Msg) {
+		msg := &Message{
+			Subject:         m.Subject,
+			Data:            m.Data,
+			Sequence:        m.Sequence,
+			RedeliveryCount: m.RedeliveryCount,
+			Timestamp:       time.Unix(0, m.Timestamp),
+			ack:             m.Ack,
+		}
+		err := handler(msg)
+		if o.AsyncAck {
+			if err != nil {
+				c.logger.Printf("Ошибка обработки сообщения %d из темы %s: %v", m.Sequence, topic, err)
+			}
+			return
+		}
+		if err != nil {
+			// Не подтверждаем сообщение, сервер доставит его повторно после AckWait
+			c.logger.Printf("Сообщение %d из темы %s не подтверждено: %v", m.Sequence, topic, err)
+			return
+		}
+		if err := m.Ack(); err != nil {
+			c.logger.Printf("Ошибка подтверждения сообщения %d из темы %s: %v", m.Sequence, topic, err)
+		}
+	}
+	stanOpts := []stan.SubscriptionOption{stan.SetManualAckMode(), stan.AckWait(o.AckWait)}
+	if o.DurableName != "" {
+		stanOpts = append(stanOpts, stan.DurableName(o.DurableName))
+	}
+	if o.MaxInflight > 0 {
+		stanOpts = append(stanOpts, stan.MaxInflight(o.MaxInflight))
+	}
+	switch {
+	case o.StartSequence > 0:
+		stanOpts = append(stanOpts, stan.StartAtSequence(o.StartSequence))
+	case !o.StartTime.IsZero():
+		stanOpts = append(stanOpts, stan.StartAtTime(o.StartTime))
+	case o.DeliverAll:
+		stanOpts = append(stanOpts, stan.DeliverAllAvailable())
+	case o.NewOnly:
+		// Подписка STAN по умолчанию получает только новые сообщения
+	}
+	if o.QueueGroup != "" {
+		// Durable очередь: реплики с одной группой делят сообщения, каждое обрабатывается один раз
+		return nc.QueueSubscribe(topic, o.QueueGroup, cb, stanOpts...)
+	}
+	return nc.Subscribe(topic, cb, stanOpts...)
+}
+
+// Subscribe подписывается на тему в режиме ручного подтверждения сообщений
+func (c *NatsClient) Subscribe(topic string, handler Handler, opts ...SubscribeOption) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -49,13 +217,13 @@ func (c *NatsClient) Subscribe(topic string, handler stan.MsgHandler) error {
 		return nil // Или возвращаем ошибку, если подписка уже существует
 	}
 
-	sub, err := c.nc.Subscribe(topic, handler, stan.DurableName("my-durable"))
+	sub, err := c.subscribe(c.nc, topic, handler, opts)
 	if err != nil {
 		c.logger.Printf("Не удалось подписаться на тему %s: %v", topic, err)
 		return err
 	}
 
-	c.subs[topic] = sub
+	c.subs[topic] = &subscription{sub: sub, handler: handler, opts: opts}
 	c.logger.Printf("Subscribed to topic: %s", topic)
 	return nil
 }
@@ -65,14 +233,14 @@ func (c *NatsClient) Unsubscribe(topic string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	sub, ok := c.subs[topic]
+	s, ok := c.subs[topic]
 	if !ok {
 		errorMessage := fmt.Sprintf("Подписка не найдена для темы: %s", topic)
 		c.logger.Println(errorMessage)
 		return errors.New(errorMessage)
 	}
 
-	err := sub.Unsubscribe()
+	err := s.sub.Unsubscribe()
 	if err != nil {
 		c.logger.Printf("Ошибка при отписке %s: %v", topic, err)
 		return err
@@ -85,18 +253,35 @@ func (c *NatsClient) Unsubscribe(topic string) error {
 
 // PublishMessage публикует новое сообщение на тему
 func (c *NatsClient) PublishMessage(topic string, message []byte) error {
-	err := c.nc.Publish(topic, message)
+	c.mu.Lock()
+	nc := c.nc
+	c.mu.Unlock()
+
+	err := nc.Publish(topic, message)
 	if err != nil {
 		c.logger.Printf("Ошибка публикации сообщения %s: %v", topic, err)
 		return err
 	}
-	c.logger.Printf("Сообщение опубликовано в тему: %s", message, topic)
+	c.logger.Printf("Сообщение опубликовано в тему: %s", topic)
 	return nil
 }
 
+// IsConnected сообщает, установлено ли соединение с сервером NATS Streaming
+func (c *NatsClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
 // Close закрывает соединение с сервером NATS Streaming
 func (c *NatsClient) Close() error {
-	err := c.nc.Close()
+	c.mu.Lock()
+	c.closed = true
+	c.setConnected(false)
+	nc := c.nc
+	c.mu.Unlock()
+
+	err := nc.Close()
 	if err != nil {
 		return err
 	}
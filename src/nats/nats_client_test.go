@@ -0,0 +1,152 @@
+package natsclient
+
+import (
+	stand "github.com/nats-io/nats-streaming-server/server"
+	"github.com/nats-io/nats-streaming-server/stores"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"wild_project/src/my_prometheus"
+)
+
+func TestNextReconnectWait(t *testing.T) {
+	assert := assert.New(t)
+
+	wait := minReconnectWait
+	var waits []time.Duration
+	for i := 0; i < 7; i++ {
+		wait = nextReconnectWait(wait)
+		waits = append(waits, wait)
+	}
+
+	assert.Equal([]time.Duration{
+		2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		maxReconnectWait, maxReconnectWait, maxReconnectWait,
+	}, waits)
+}
+
+func TestQueueGroupSharesMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	srv, err := StartEmbeddedServer("test-cluster")
+	if err != nil {
+		t.Fatalf("Не удалось запустить встроенный сервер: %v", err)
+	}
+	defer srv.Shutdown()
+
+	var mu sync.Mutex
+	received := make(map[uint64]int)
+	total := make(chan struct{}, 20)
+
+	for _, clientID := range []string{"replica-1", "replica-2"} {
+		client, err := NewNatsClient(srv.ClientURL(), "test-cluster", clientID)
+		if err != nil {
+			t.Fatalf("Не удалось подключиться: %v", err)
+		}
+		defer client.Close()
+
+		err = client.Subscribe("orders", func(m *Message) error {
+			mu.Lock()
+			received[m.Sequence]++
+			mu.Unlock()
+			total <- struct{}{}
+			return nil
+		}, DurableName("ingest"), QueueGroup("order-service"))
+		assert.NoError(err)
+	}
+
+	publisher, err := NewNatsClient(srv.ClientURL(), "test-cluster", "publisher")
+	if err != nil {
+		t.Fatalf("Не удалось подключиться: %v", err)
+	}
+	defer publisher.Close()
+	for i := 0; i < 10; i++ {
+		assert.NoError(publisher.PublishMessage("orders", []byte("order")))
+	}
+
+	for i := 0; i < 10; i++ {
+		select {
+		case <-total:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Не все сообщения были доставлены")
+		}
+	}
+	// Лишних доставок быть не должно: каждое сообщение получает только одна реплика
+	select {
+	case <-total:
+		t.Fatal("Сообщение доставлено больше одного раза")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(received, 10)
+	for seq, count := range received {
+		assert.Equal(1, count, "сообщение %d", seq)
+	}
+}
+
+// runFileStoreServer запускает nats-streaming-server с хранением в каталоге dir на порту port,
+// -1 означает случайный свободный порт
+func runFileStoreServer(t *testing.T, dir string, port int) *stand.StanServer {
+	stanOpts := stand.GetDefaultOptions()
+	stanOpts.ID = "test-cluster"
+	stanOpts.StoreType = stores.TypeFile
+	stanOpts.FilestoreDir = dir
+	natsOpts := stand.DefaultNatsServerOptions
+	natsOpts.Port = port
+	srv, err := stand.RunServerWithOpts(stanOpts, &natsOpts)
+	if err != nil {
+		t.Fatalf("Не удалось запустить сервер: %v", err)
+	}
+	return srv
+}
+
+func TestReconnectAfterServerRestart(t *testing.T) {
+	assert := assert.New(t)
+	defer func(interval, maxOut int) { pingInterval, pingMaxOut = interval, maxOut }(pingInterval, pingMaxOut)
+	pingInterval, pingMaxOut = 1, 2
+
+	dir := t.TempDir()
+	srv := runFileStoreServer(t, dir, -1)
+	port := srv.ClientURL()[strings.LastIndex(srv.ClientURL(), ":")+1:]
+
+	client, err := NewNatsClient(srv.ClientURL(), "test-cluster", "replica-1")
+	if err != nil {
+		srv.Shutdown()
+		t.Fatalf("Не удалось подключиться: %v", err)
+	}
+	defer client.Close()
+	received := make(chan *Message, 10)
+	assert.NoError(client.Subscribe("orders", func(m *Message) error {
+		received <- m
+		return nil
+	}, DurableName("ingest")))
+	assert.Equal(float64(1), testutil.ToFloat64(my_prometheus.BrokerConnected))
+
+	// Остановка сервера замечается по неотвеченным пингам
+	srv.Shutdown()
+	assert.Eventually(func() bool { return !client.IsConnected() }, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(float64(0), testutil.ToFloat64(my_prometheus.BrokerConnected))
+
+	// Сервер поднимается на том же порту с тем же хранилищем, клиент переподключается сам
+	portNumber, err := strconv.Atoi(port)
+	assert.NoError(err)
+	srv = runFileStoreServer(t, dir, portNumber)
+	defer srv.Shutdown()
+	assert.Eventually(client.IsConnected, 30*time.Second, 50*time.Millisecond)
+	assert.Equal(float64(1), testutil.ToFloat64(my_prometheus.BrokerConnected))
+
+	// Durable подписка восстановлена и получает новые сообщения
+	assert.NoError(client.PublishMessage("orders", []byte("after-restart")))
+	select {
+	case m := <-received:
+		assert.Equal("after-restart", string(m.Data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Сообщение после перезапуска сервера не доставлено")
+	}
+}
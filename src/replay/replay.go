@@ -0,0 +1,124 @@
+package replay
+
+import (
+	"errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"log"
+	"sync"
+	"time"
+	"wild_project/src/cache"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
+	"wild_project/src/utils"
+)
+
+var logger *log.Logger
+var filePath = "logs/replay.log"
+
+func init() {
+	logger = log.New(&lumberjack.Logger{
+		Filename:   filePath,
+		MaxSize:    10, // Размер файла в мегабайтах до ротации
+		MaxBackups: 3,  // Максимальное количество старых файлов логов
+		MaxAge:     28, // Максимальное количество дней для хранения логов
+		Compress:   true,
+	}, "REPLAY: ", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// DefaultIdleTimeout время ожидания следующего сообщения, если IdleTimeout не задан
+const DefaultIdleTimeout = 5 * time.Second
+
+// Options параметры повторного чтения канала.
+// Если не заданы ни StartSequence, ни StartTime, канал читается с самого начала.
+type Options struct {
+	Channel       string
+	StartSequence uint64
+	StartTime     time.Time
+	DryRun        bool          // Только проверить заказы, ничего не записывая в БД
+	IdleTimeout   time.Duration // Чтение завершается, если за это время не пришло ни одного сообщения, 0 - DefaultIdleTimeout
+}
+
+// Report количество заказов по итогам обработки
+type Report struct {
+	Inserted   int `json:"inserted"`
+	Updated    int `json:"updated"`
+	Duplicates int `json:"duplicates"` // Включая устаревшие события
+	Rejected   int `json:"rejected"`
+	Failed     int `json:"failed"`
+}
+
+// Run перечитывает канал через временную подписку без durable имени и пропускает сообщения через ProcessOrder
+func Run(broker natsclient.Broker, orderCache cache.Cache, repo repository.OrderRepository, opts Options) (Report, error) {
+	if opts.Channel == "" {
+		return Report{}, errors.New("не задан канал для повторного чтения")
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+
+	var mu sync.Mutex
+	var report Report
+	activity := make(chan struct{}, 1)
+
+	subOpts := []natsclient.SubscribeOption{natsclient.NonDurable()}
+	switch {
+	case opts.StartSequence > 0:
+		subOpts = append(subOpts, natsclient.StartAtSequence(opts.StartSequence))
+	case !opts.StartTime.IsZero():
+		subOpts = append(subOpts, natsclient.StartAtTime(opts.StartTime))
+	default:
+		subOpts = append(subOpts, natsclient.DeliverAllAvailable())
+	}
+
+	err := broker.Subscribe(opts.Channel, func(m *natsclient.Message) error {
+		result, err := utils.ProcessOrder(orderCache, repo, m, opts.DryRun)
+
+		mu.Lock()
+		switch result {
+		case utils.ResultInserted:
+			report.Inserted++
+		case utils.ResultUpdated:
+			report.Updated++
+		case utils.ResultDuplicate, utils.ResultStale:
+			report.Duplicates++
+		case utils.ResultRejected:
+			report.Rejected++
+		case utils.ResultFailed:
+			report.Failed++
+		}
+		mu.Unlock()
+		if err != nil {
+			logger.Printf("Сообщение %d: %v", m.Sequence, err)
+		} else if !opts.DryRun {
+			orderCache.MarkApplied(m.Sequence)
+		}
+
+		select {
+		case activity <- struct{}{}:
+		default:
+		}
+		// Сообщение подтверждается в любом случае, повторное чтение не должно зацикливаться на ошибках
+		return nil
+	}, subOpts...)
+	if err != nil {
+		return Report{}, err
+	}
+
+	// Ждем, пока сообщения перестанут приходить
+	for waiting := true; waiting; {
+		select {
+		case <-activity:
+		case <-time.After(opts.IdleTimeout):
+			waiting = false
+		}
+	}
+
+	if err := broker.Unsubscribe(opts.Channel); err != nil {
+		return Report{}, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	logger.Printf("Повторное чтение %s завершено: %+v", opts.Channel, report)
+	return report, nil
+}
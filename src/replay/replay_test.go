@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/invalidation"
+	"wild_project/src/models"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
+	"wild_project/src/tests"
+	"wild_project/src/tests/testdb"
+	"wild_project/src/utils"
+)
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+
+	messages, err := tests.GenerateTestMessages(3)
+	assert.NoError(err)
+	for _, message := range messages {
+		assert.NoError(broker.PublishMessage("orders", []byte(message)))
+	}
+	assert.NoError(broker.PublishMessage("orders", []byte("not a json")))
+
+	// Первый заказ уже сохранен
+	order, err := utils.DeserializeOrder(messages[0])
+	assert.NoError(err)
+	assert.NoError(db.Create(&order).Error)
+
+	opts := Options{Channel: "orders", DryRun: true, IdleTimeout: 50 * time.Millisecond}
+	report, err := Run(broker, cache.NewOrderCache(), repo, opts)
+	assert.NoError(err)
+	assert.Equal(Report{Inserted: 2, Duplicates: 1, Rejected: 1}, report)
+
+	var stored int64
+	db.Model(&models.Order{}).Count(&stored)
+	assert.Equal(int64(1), stored, "в режиме dry-run в БД ничего не записывается")
+
+	opts = Options{Channel: "orders", StartSequence: 2, IdleTimeout: 50 * time.Millisecond}
+	report, err = Run(broker, cache.NewOrderCache(), repo, opts)
+	assert.NoError(err)
+	assert.Equal(Report{Inserted: 2, Rejected: 1}, report)
+
+	db.Model(&models.Order{}).Count(&stored)
+	assert.Equal(int64(3), stored)
+}
+
+// Без IdleTimeout чтение ждет сообщений DefaultIdleTimeout, а не завершается сразу
+func TestRunDefaultIdleTimeout(t *testing.T) {
+	assert := assert.New(t)
+	repo := repository.NewGormRepository(testdb.Open(t))
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+
+	messages, err := tests.GenerateTestMessages(2)
+	assert.NoError(err)
+	for _, message := range messages {
+		assert.NoError(broker.PublishMessage("orders", []byte(message)))
+	}
+
+	report, err := Run(broker, cache.NewOrderCache(), repo, Options{Channel: "orders", DryRun: true})
+	assert.NoError(err)
+	assert.Equal(Report{Inserted: 2}, report)
+}
+
+func TestRunRefreshesRunningReplicas(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+
+	messages, err := tests.GenerateTestMessages(1)
+	assert.NoError(err)
+	order, err := utils.DeserializeOrder(messages[0])
+	assert.NoError(err)
+	order.Version = 1
+	assert.NoError(repo.Create(&order))
+
+	// Работающая реплика уже держит заказ в кэше
+	replica := invalidation.New(cache.NewOrderCache(), broker, repo, "cache-events")
+	assert.NoError(replica.Start())
+	replica.Add(order)
+
+	changed := order
+	changed.TrackNumber = "REPLAYED"
+	changed.Version = 2
+	data, err := json.Marshal(models.OrderEvent{Type: models.EventUpdated, OrderUID: order.OrderUID, Version: 2, Order: &changed})
+	assert.NoError(err)
+	assert.NoError(broker.PublishMessage("orders", data))
+
+	replayCache := invalidation.New(cache.NewOrderCache(), broker, repo, "cache-events")
+	report, err := Run(broker, replayCache, repo, Options{Channel: "orders", IdleTimeout: 50 * time.Millisecond})
+	assert.NoError(err)
+	assert.Equal(Report{Updated: 1}, report)
+
+	assert.Eventually(func() bool {
+		cached, _ := replica.Get(order.OrderUID)
+		return cached.TrackNumber == "REPLAYED"
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"os"
+	"testing"
+	"time"
+	"wild_project/src/migrations"
+	"wild_project/src/models"
+	"wild_project/src/tests/testdb"
+)
+
+// benchmarkOrder заказ с доставкой, оплатой и тремя позициями, как в канале заказов
+func benchmarkOrder(i int) models.Order {
+	order := models.Order{
+		OrderUID:    fmt.Sprintf("order-%d", i),
+		TrackNumber: fmt.Sprintf("TRACK-%d", i),
+		Entry:       "WBIL",
+		Locale:      "en",
+		CustomerID:  fmt.Sprintf("customer-%d", i%100),
+		Shardkey:    "9",
+		SmID:        "99",
+		DateCreated: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+		OofShard:    "1",
+		Version:     1,
+		Delivery:    models.Delivery{Name: "Test Testov", Phone: "+9720000000", City: "Kiryat Mozkin", Adress: "Ploshad Mira 15", Email: "test@gmail.com"},
+		Payment:     models.Payment{Transaction: fmt.Sprintf("tx-%d", i), Currency: "USD", Provider: "wbpay", Amount: 1817, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317},
+	}
+	for j := 0; j < 3; j++ {
+		order.Items = append(order.Items, models.Items{
+			ChrtID: 9934930 + j, TrackNumber: order.TrackNumber, Price: 453, RID: fmt.Sprintf("rid-%d-%d", i, j),
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202,
+		})
+	}
+	return order
+}
+
+// benchmarkDB открывает БД для бенчмарка. С TEST_DATABASE_DSN это PostgreSQL со схемой из миграций:
+// только там документ хранится в JSONB с вычисляемыми столбцами и GIN индексом. Без нее - SQLite,
+// где важнее соотношение, чем абсолютные числа: в PostgreSQL к ним добавляются сетевые задержки
+// на каждый запрос, которых у документов меньше.
+func benchmarkDB(b *testing.B) *gorm.DB {
+	if os.Getenv(testdb.PostgresDSNEnv) == "" {
+		return testdb.Open(b)
+	}
+	db := testdb.OpenPostgres(b)
+	m, err := migrations.New(db)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := m.Up(); err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+// benchmarkBackends запускает бенчмарк для реляционной схемы и для документов
+func benchmarkBackends(b *testing.B, bench func(b *testing.B, repo OrderRepository)) {
+	for _, backend := range []string{BackendRelational, BackendDocument} {
+		b.Run(backend, func(b *testing.B) {
+			repo, err := New(backend, benchmarkDB(b))
+			if err != nil {
+				b.Fatal(err)
+			}
+			bench(b, repo)
+		})
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	benchmarkBackends(b, func(b *testing.B, repo OrderRepository) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			order := benchmarkOrder(i)
+			if err := repo.Create(&order); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "orders/s")
+	})
+}
+
+// BenchmarkRestore чтение всех заказов, как при загрузке кэша после перезапуска
+func BenchmarkRestore(b *testing.B) {
+	const orders = 2000
+	benchmarkBackends(b, func(b *testing.B, repo OrderRepository) {
+		// Пачки не больше лимита параметров запроса SQLite
+		batch := make([]models.Order, 0, 100)
+		for i := 0; i < orders; i++ {
+			batch = append(batch, benchmarkOrder(i))
+			if len(batch) == cap(batch) || i == orders-1 {
+				if err := repo.CreateBatch(batch); err != nil {
+					b.Fatal(err)
+				}
+				batch = batch[:0]
+			}
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			restored := 0
+			err := repo.StreamAll(StreamOptions{}, func(chunk []models.Order) error {
+				restored += len(chunk)
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if restored != orders {
+				b.Fatalf("восстановлено %d заказов из %d", restored, orders)
+			}
+		}
+		b.ReportMetric(float64(orders*b.N)/b.Elapsed().Seconds(), "orders/s")
+	})
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"strings"
+	"wild_project/src/models"
+)
+
+// Коды ошибок PostgreSQL для нарушенных ограничений
+const (
+	pgNotNullViolation    = "23502"
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+)
+
+// translate заменяет ошибку БД о нарушенном ограничении на ErrDuplicateOrder, ErrDuplicateTransaction
+// или ErrConstraintViolation, остальные ошибки возвращаются без изменений
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return uniqueViolation(pgErr.ConstraintName)
+		case pgNotNullViolation:
+			return fmt.Errorf("%w: %s.%s не задано", ErrConstraintViolation, pgErr.TableName, pgErr.ColumnName)
+		case pgForeignKeyViolation, pgCheckViolation:
+			return fmt.Errorf("%w: %s", ErrConstraintViolation, pgErr.ConstraintName)
+		}
+		return err
+	}
+
+	// SQLite в тестах сообщает о нарушении только текстом: "UNIQUE constraint failed: orders.order_uid",
+	// "UNIQUE constraint failed: index 'idx_order_documents_transaction'", "CHECK constraint failed: chk_items_price"
+	msg := err.Error()
+	if _, columns, found := strings.Cut(msg, "UNIQUE constraint failed: "); found {
+		if _, index, found := strings.Cut(columns, "index '"); found {
+			name, _, _ := strings.Cut(index, "'")
+			return uniqueViolation(name)
+		}
+		table, column, _ := strings.Cut(strings.Fields(columns)[0], ".")
+		// Имя индекса, которое дает gorm и миграции
+		return uniqueViolation("idx_" + table + "_" + strings.TrimSuffix(column, ","))
+	}
+	if _, constraint, found := strings.Cut(msg, " constraint failed: "); found {
+		return fmt.Errorf("%w: %s", ErrConstraintViolation, strings.Fields(constraint)[0])
+	}
+	return err
+}
+
+// uniqueViolation возвращает доменную ошибку для нарушенного уникального индекса
+func uniqueViolation(constraint string) error {
+	switch constraint {
+	case "idx_orders_order_uid", "idx_order_documents_order_uid":
+		return ErrDuplicateOrder
+	case "idx_payments_transaction", "idx_order_documents_transaction":
+		return ErrDuplicateTransaction
+	}
+	return fmt.Errorf("%w: %s", ErrConstraintViolation, constraint)
+}
+
+// checkConstraints проверяет заказ на CHECK ограничения схемы. Используется хранилищем в памяти,
+// чтобы оно отклоняло те же заказы, что и БД.
+func checkConstraints(order models.Order) error {
+	violated := func(constraint string) error {
+		return fmt.Errorf("%w: %s", ErrConstraintViolation, constraint)
+	}
+	switch {
+	case order.OrderUID == "":
+		return violated("chk_orders_order_uid")
+	case order.Payment.Amount < 0:
+		return violated("chk_payments_amount")
+	case order.Payment.DeliveryCost < 0:
+		return violated("chk_payments_delivery_cost")
+	case order.Payment.GoodsTotal < 0:
+		return violated("chk_payments_goods_total")
+	case order.Payment.CustomFee < 0:
+		return violated("chk_payments_custom_fee")
+	}
+	for _, item := range order.Items {
+		switch {
+		case item.Price < 0:
+			return violated("chk_items_price")
+		case item.TotalPrice < 0:
+			return violated("chk_items_total_price")
+		case item.Sale < 0 || item.Sale > 100:
+			return violated("chk_items_sale")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,403 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"wild_project/src/models"
+)
+
+// orderDocument строка таблицы order_documents. Столбцы order_uid, track_number, customer_id,
+// date_created и version вычисляются БД из документа, поэтому доступны только для чтения.
+type orderDocument struct {
+	ID          uint `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Document    string
+	OrderUID    string `gorm:"->"`
+	TrackNumber string `gorm:"->"`
+	CustomerID  string `gorm:"->"`
+	Version     int    `gorm:"->"`
+}
+
+func (orderDocument) TableName() string {
+	return "order_documents"
+}
+
+// DocumentRepository хранит заказ целиком одним JSONB документом в таблице order_documents.
+// Заказ читается одной строкой без сборки из четырех таблиц. Поля для поиска вынесены
+// в вычисляемые столбцы, поиск по транзакции и RID идет по индексам документа.
+type DocumentRepository struct {
+	db       *gorm.DB
+	postgres bool
+	journaling
+}
+
+// NewDocumentRepository создает хранилище документов поверх подключения db
+func NewDocumentRepository(db *gorm.DB) *DocumentRepository {
+	return &DocumentRepository{db: db, postgres: db.Dialector.Name() == "postgres"}
+}
+
+// encodeDocument сериализует заказ без служебных полей записей, их хранят столбцы строки
+func encodeDocument(order models.Order) (string, error) {
+	order.Model = gorm.Model{}
+	order.Delivery.Model = gorm.Model{}
+	order.Payment.Model = gorm.Model{}
+	order.Items = append([]models.Items(nil), order.Items...)
+	for i := range order.Items {
+		order.Items[i].Model = gorm.Model{}
+	}
+	data, err := json.Marshal(order)
+	return string(data), err
+}
+
+// decode восстанавливает заказ из документа и столбцов строки
+func (d orderDocument) decode() (models.Order, error) {
+	var order models.Order
+	if err := json.Unmarshal([]byte(d.Document), &order); err != nil {
+		return models.Order{}, fmt.Errorf("документ заказа %d: %w", d.ID, err)
+	}
+	order.ID = d.ID
+	order.CreatedAt = d.CreatedAt
+	order.UpdatedAt = d.UpdatedAt
+	return order, nil
+}
+
+// decodeAll восстанавливает заказы из строк, переиспользуя срез orders
+func decodeAll(rows []orderDocument, orders []models.Order) ([]models.Order, error) {
+	orders = orders[:0]
+	for _, row := range rows {
+		order, err := row.decode()
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// prepare проверяет заказ на ограничения схемы и проставляет OrderUID в связанные записи,
+// как это делает внешний ключ в реляционной схеме
+func prepare(order *models.Order) error {
+	if err := checkConstraints(*order); err != nil {
+		return err
+	}
+	order.Delivery.OrderUID = order.OrderUID
+	order.Payment.OrderUID = order.OrderUID
+	for i := range order.Items {
+		order.Items[i].OrderUID = order.OrderUID
+	}
+	return nil
+}
+
+func (r *DocumentRepository) find(query *gorm.DB) ([]models.Order, error) {
+	var rows []orderDocument
+	if err := query.Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return decodeAll(rows, nil)
+}
+
+// GetByUID загружает заказ по OrderUID
+func (r *DocumentRepository) GetByUID(orderUID string) (models.Order, error) {
+	return r.getByUID(r.db, orderUID)
+}
+
+func (r *DocumentRepository) getByUID(db *gorm.DB, orderUID string) (models.Order, error) {
+	var row orderDocument
+	if err := db.Where("order_uid = ?", orderUID).First(&row).Error; err != nil {
+		return models.Order{}, notFound(err)
+	}
+	return row.decode()
+}
+
+// WithJournal возвращает копию хранилища, которая записывает изменения заказов в journal
+func (r *DocumentRepository) WithJournal(journal Journal) OrderRepository {
+	journaled := *r
+	journaled.journal = journal
+	return &journaled
+}
+
+// WithSource возвращает копию хранилища, которая приписывает изменения источнику source(orderUID)
+func (r *DocumentRepository) WithSource(source func(orderUID string) string) OrderRepository {
+	attributed := *r
+	attributed.source = source
+	return &attributed
+}
+
+// recordChange записывает в журнал изменение заказа из previous в состояние, прочитанное в транзакции tx
+func (r *DocumentRepository) recordChange(tx *gorm.DB, orderUID string, previous *models.Order) error {
+	if !r.enabled() {
+		return nil
+	}
+	current, err := r.getByUID(tx, orderUID)
+	if err != nil {
+		return err
+	}
+	return r.record(tx, orderUID, previous, &current)
+}
+
+// GetByUIDs загружает заказы по списку OrderUID
+func (r *DocumentRepository) GetByUIDs(orderUIDs []string) ([]models.Order, error) {
+	if len(orderUIDs) == 0 {
+		return []models.Order{}, nil
+	}
+	return r.find(r.db.Where("order_uid IN ?", orderUIDs))
+}
+
+// ExistingUIDs возвращает OrderUID из списка, документы которых есть в таблице, по вычисляемому столбцу
+func (r *DocumentRepository) ExistingUIDs(orderUIDs []string) ([]string, error) {
+	var uids []string
+	if len(orderUIDs) == 0 {
+		return uids, nil
+	}
+	err := r.db.Model(&orderDocument{}).Where("order_uid IN ?", orderUIDs).Pluck("order_uid", &uids).Error
+	return uids, err
+}
+
+// FindBy ищет заказы по вычисляемому столбцу или, для транзакции и RID, по содержимому документа.
+// В PostgreSQL транзакцию находит индекс выражения, RID - GIN индекс документа. SQLite в тестах
+// разбирает документ функциями json.
+func (r *DocumentRepository) FindBy(field string, value string) ([]models.Order, error) {
+	query := r.db
+	switch field {
+	case FieldTrackNumber, FieldCustomerID:
+		query = query.Where(field+" = ?", value)
+	case FieldTransaction:
+		if r.postgres {
+			query = query.Where("document -> 'payment' ->> 'Transaction' = ?", value)
+		} else {
+			query = query.Where("document ->> '$.payment.Transaction' = ?", value)
+		}
+	case FieldRID:
+		if r.postgres {
+			pattern, err := json.Marshal(map[string]interface{}{"items": []map[string]string{{"RID": value}}})
+			if err != nil {
+				return nil, err
+			}
+			query = query.Where("document @> ?::jsonb", string(pattern))
+		} else {
+			query = query.Where("EXISTS (SELECT 1 FROM json_each(order_documents.document, '$.items') AS item WHERE item.value ->> '$.RID' = ?)", value)
+		}
+	default:
+		return nil, fmt.Errorf("поиск по полю %s не поддерживается", field)
+	}
+	return r.find(query)
+}
+
+// insert сохраняет новый заказ одной строкой и заполняет его id и время записи
+func insert(tx *gorm.DB, order *models.Order) error {
+	if err := prepare(order); err != nil {
+		return err
+	}
+	document, err := encodeDocument(*order)
+	if err != nil {
+		return err
+	}
+	row := orderDocument{Document: document}
+	if err := tx.Create(&row).Error; err != nil {
+		return err
+	}
+	order.ID = row.ID
+	order.CreatedAt = row.CreatedAt
+	order.UpdatedAt = row.UpdatedAt
+	return nil
+}
+
+// Create сохраняет новый заказ
+func (r *DocumentRepository) Create(order *models.Order) error {
+	return translate(r.db.Transaction(func(tx *gorm.DB) error {
+		if err := insert(tx, order); err != nil {
+			return err
+		}
+		return r.record(tx, order.OrderUID, nil, order)
+	}))
+}
+
+// CreateBatch сохраняет пачку заказов одной транзакцией
+func (r *DocumentRepository) CreateBatch(orders []models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	return translate(r.db.Transaction(func(tx *gorm.DB) error {
+		rows := make([]orderDocument, len(orders))
+		for i := range orders {
+			if err := prepare(&orders[i]); err != nil {
+				return err
+			}
+			document, err := encodeDocument(orders[i])
+			if err != nil {
+				return err
+			}
+			rows[i].Document = document
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+		for i := range orders {
+			orders[i].ID = rows[i].ID
+			orders[i].CreatedAt = rows[i].CreatedAt
+			orders[i].UpdatedAt = rows[i].UpdatedAt
+			if err := r.record(tx, orders[i].OrderUID, nil, &orders[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// Upsert создает заказ или заменяет документ сохраненного заказа более новой версией.
+// Строка документа блокируется до конца транзакции, поэтому параллельная замена ждет этой.
+func (r *DocumentRepository) Upsert(order *models.Order) error {
+	return translate(r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := r.getByUID(forUpdate(tx), order.OrderUID)
+		if errors.Is(err, ErrNotFound) {
+			if err := insert(tx, order); err != nil {
+				return err
+			}
+			return r.record(tx, order.OrderUID, nil, order)
+		}
+		if err != nil {
+			return err
+		}
+		if order.Version <= current.Version {
+			return ErrConcurrentUpdate
+		}
+		if err := prepare(order); err != nil {
+			return err
+		}
+		// Отмена не входит в заменяемые поля
+		order.CancelledAt = current.CancelledAt
+		if err := replaceDocument(tx, current, *order); err != nil {
+			return err
+		}
+		order.Model = current.Model
+		return r.recordChange(tx, order.OrderUID, &current)
+	}))
+}
+
+// replaceDocument записывает документ next, если версия заказа не изменилась после чтения current
+func replaceDocument(tx *gorm.DB, current models.Order, next models.Order) error {
+	document, err := encodeDocument(next)
+	if err != nil {
+		return err
+	}
+	res := tx.Model(&orderDocument{}).
+		Where("id = ? AND version = ?", current.ID, current.Version).
+		Updates(map[string]interface{}{"document": document, "updated_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrConcurrentUpdate
+	}
+	return nil
+}
+
+// change применяет изменение к сохраненному документу и переводит заказ на версию version.
+// Документ читается под блокировкой строки, изменение записывается в журнал в той же транзакции.
+func (r *DocumentRepository) change(current models.Order, version int, apply func(order *models.Order) error) error {
+	return translate(r.db.Transaction(func(tx *gorm.DB) error {
+		previous, err := r.getByUID(forUpdate(tx), current.OrderUID)
+		if errors.Is(err, ErrNotFound) {
+			return ErrConcurrentUpdate
+		}
+		if err != nil {
+			return err
+		}
+		if previous.Version != current.Version {
+			return ErrConcurrentUpdate
+		}
+		next := copyOrder(previous)
+		if err := apply(&next); err != nil {
+			return err
+		}
+		next.Version = version
+		if err := replaceDocument(tx, current, next); err != nil {
+			return err
+		}
+		return r.recordChange(tx, current.OrderUID, &previous)
+	}))
+}
+
+// Cancel отмечает заказ отмененным
+func (r *DocumentRepository) Cancel(current models.Order, version int, at time.Time) error {
+	return r.change(current, version, func(order *models.Order) error {
+		order.CancelledAt = &at
+		return nil
+	})
+}
+
+// SetItemStatus меняет статус позиции
+func (r *DocumentRepository) SetItemStatus(current models.Order, version int, chrtID int, status int) error {
+	return r.change(current, version, func(order *models.Order) error {
+		return setItemStatus(order, chrtID, status)
+	})
+}
+
+// Delete удаляет документ заказа
+func (r *DocumentRepository) Delete(orderUID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var previous *models.Order
+		if r.enabled() {
+			locked, err := r.getByUID(forUpdate(tx), orderUID)
+			if err != nil {
+				return err
+			}
+			previous = &locked
+		}
+		res := tx.Where("order_uid = ?", orderUID).Delete(&orderDocument{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return r.record(tx, orderUID, previous, nil)
+	})
+}
+
+// ListPage возвращает страницу заказов после afterID
+func (r *DocumentRepository) ListPage(afterID uint, limit int) ([]models.Order, error) {
+	return r.find(r.db.Where("id > ?", afterID).Limit(limit))
+}
+
+// StreamAll читает документы пачками через FindInBatches
+func (r *DocumentRepository) StreamAll(opts StreamOptions, fn func(orders []models.Order) error) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize < 1 {
+		chunkSize = DefaultChunkSize
+	}
+	query := r.db.Model(&orderDocument{})
+	if opts.Newest > 0 {
+		var boundary []uint
+		err := r.db.Model(&orderDocument{}).Order("id desc").Offset(opts.Newest-1).Limit(1).Pluck("id", &boundary).Error
+		if err != nil {
+			return err
+		}
+		if len(boundary) > 0 {
+			query = query.Where("id >= ?", boundary[0])
+		}
+	}
+	if !opts.UpdatedSince.IsZero() {
+		query = query.Where("updated_at >= ?", opts.UpdatedSince)
+	}
+
+	var rows []orderDocument
+	var orders []models.Order
+	return query.FindInBatches(&rows, chunkSize, func(tx *gorm.DB, batch int) error {
+		var err error
+		if orders, err = decodeAll(rows, orders); err != nil {
+			return err
+		}
+		return fn(orders)
+	}).Error
+}
+
+var (
+	_ OrderRepository = (*DocumentRepository)(nil)
+	_ Journaled       = (*DocumentRepository)(nil)
+	_ Attributed      = (*DocumentRepository)(nil)
+)
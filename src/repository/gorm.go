@@ -0,0 +1,346 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"wild_project/src/models"
+)
+
+// GormRepository хранит заказы в таблицах orders, deliveries, payments и items через gorm
+type GormRepository struct {
+	db *gorm.DB
+	journaling
+}
+
+// NewGormRepository создает хранилище заказов поверх подключения db
+func NewGormRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{db: db}
+}
+
+// preloaded подключает к запросу загрузку доставки, оплаты и позиций заказа,
+// чтобы заказ читался из БД целиком, а не только строкой таблицы orders
+func preloaded(db *gorm.DB) *gorm.DB {
+	return db.Preload("Delivery").Preload("Payment").Preload("Items", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	})
+}
+
+// notFound заменяет ошибку gorm об отсутствии записи на ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// GetByUID загружает заказ со всеми связанными записями по OrderUID
+func (r *GormRepository) GetByUID(orderUID string) (models.Order, error) {
+	return getByUID(r.db, orderUID)
+}
+
+func getByUID(db *gorm.DB, orderUID string) (models.Order, error) {
+	var order models.Order
+	err := preloaded(db).Where("order_uid = ?", orderUID).First(&order).Error
+	return order, notFound(err)
+}
+
+// lockedOrder блокирует строку заказа до конца транзакции tx и читает заказ целиком
+func lockedOrder(tx *gorm.DB, orderUID string) (models.Order, error) {
+	var ids []uint
+	if err := forUpdate(tx).Model(&models.Order{}).Where("order_uid = ?", orderUID).Pluck("id", &ids).Error; err != nil {
+		return models.Order{}, err
+	}
+	if len(ids) == 0 {
+		return models.Order{}, ErrNotFound
+	}
+	return getByUID(tx, orderUID)
+}
+
+// WithJournal возвращает копию хранилища, которая записывает изменения заказов в journal
+func (r *GormRepository) WithJournal(journal Journal) OrderRepository {
+	journaled := *r
+	journaled.journal = journal
+	return &journaled
+}
+
+// WithSource возвращает копию хранилища, которая приписывает изменения источнику source(orderUID)
+func (r *GormRepository) WithSource(source func(orderUID string) string) OrderRepository {
+	attributed := *r
+	attributed.source = source
+	return &attributed
+}
+
+// recordChange записывает в журнал изменение заказа из previous в состояние, прочитанное в транзакции tx
+func (r *GormRepository) recordChange(tx *gorm.DB, orderUID string, previous *models.Order) error {
+	if !r.enabled() {
+		return nil
+	}
+	current, err := getByUID(tx, orderUID)
+	if err != nil {
+		return err
+	}
+	return r.record(tx, orderUID, previous, &current)
+}
+
+// GetByUIDs загружает заказы со связанными записями по списку OrderUID
+func (r *GormRepository) GetByUIDs(orderUIDs []string) ([]models.Order, error) {
+	var orders []models.Order
+	if len(orderUIDs) == 0 {
+		return orders, nil
+	}
+	err := preloaded(r.db).Where("order_uid IN ?", orderUIDs).Order("id").Find(&orders).Error
+	return orders, err
+}
+
+// ExistingUIDs возвращает OrderUID из списка, которые есть в таблице orders
+func (r *GormRepository) ExistingUIDs(orderUIDs []string) ([]string, error) {
+	var uids []string
+	if len(orderUIDs) == 0 {
+		return uids, nil
+	}
+	err := r.db.Model(&models.Order{}).Where("order_uid IN ?", orderUIDs).Pluck("order_uid", &uids).Error
+	return uids, err
+}
+
+// FindBy ищет заказы по полю заказа или, для транзакции и RID, по полю оплаты и позиций
+func (r *GormRepository) FindBy(field string, value string) ([]models.Order, error) {
+	query := preloaded(r.db).Order("id")
+	switch field {
+	case FieldTrackNumber:
+		query = query.Where(&models.Order{TrackNumber: value})
+	case FieldCustomerID:
+		query = query.Where(&models.Order{CustomerID: value})
+	case FieldTransaction:
+		query = query.Where("order_uid IN (?)", r.db.Model(&models.Payment{}).Select("order_uid").Where(&models.Payment{Transaction: value}))
+	case FieldRID:
+		query = query.Where("order_uid IN (?)", r.db.Model(&models.Items{}).Select("order_uid").Where(&models.Items{RID: value}))
+	default:
+		return nil, fmt.Errorf("поиск по полю %s не поддерживается", field)
+	}
+	var orders []models.Order
+	err := query.Find(&orders).Error
+	return orders, err
+}
+
+// Create сохраняет заказ со связанными записями в одной транзакции
+func (r *GormRepository) Create(order *models.Order) error {
+	return translate(r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		return r.record(tx, order.OrderUID, nil, order)
+	}))
+}
+
+// CreateBatch сохраняет пачку заказов одной транзакцией, связанные записи вставляются
+// общими запросами для всей пачки
+func (r *GormRepository) CreateBatch(orders []models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	return translate(r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&orders).Error; err != nil {
+			return err
+		}
+		for i := range orders {
+			if err := r.record(tx, orders[i].OrderUID, nil, &orders[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// Upsert создает заказ или заменяет сохраненный заказ более новой версией.
+// Строка заказа блокируется до конца транзакции, поэтому параллельная замена ждет этой.
+func (r *GormRepository) Upsert(order *models.Order) error {
+	return translate(r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockedOrder(tx, order.OrderUID)
+		if errors.Is(err, ErrNotFound) {
+			if err := tx.Create(order).Error; err != nil {
+				return err
+			}
+			return r.record(tx, order.OrderUID, nil, order)
+		}
+		if err != nil {
+			return err
+		}
+		if order.Version <= current.Version {
+			return ErrConcurrentUpdate
+		}
+		if err := replaceOrder(tx, current, order); err != nil {
+			return err
+		}
+		return r.recordChange(tx, order.OrderUID, &current)
+	}))
+}
+
+// replaceOrder заменяет поля заказа, доставку, оплату и позиции новым состоянием next
+func replaceOrder(tx *gorm.DB, current models.Order, next *models.Order) error {
+	res := tx.Model(&models.Order{}).
+		Where("id = ? AND version = ?", current.ID, current.Version).
+		Select("track_number", "entry", "locale", "internal_signature", "customer_id", "delivery_service",
+			"shardkey", "sm_id", "date_created", "oof_shard", "version").
+		Updates(next)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrConcurrentUpdate
+	}
+	next.Model = current.Model
+
+	// Сохраняем идентификаторы и время создания существующих записей, отсутствующие записи создаются
+	next.Delivery.Model = current.Delivery.Model
+	next.Delivery.OrderUID = current.OrderUID
+	if err := tx.Save(&next.Delivery).Error; err != nil {
+		return err
+	}
+	next.Payment.Model = current.Payment.Model
+	next.Payment.OrderUID = current.OrderUID
+	if err := tx.Save(&next.Payment).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Unscoped().Where("order_uid = ?", current.OrderUID).Delete(&models.Items{}).Error; err != nil {
+		return err
+	}
+	for i := range next.Items {
+		next.Items[i].Model = gorm.Model{}
+		next.Items[i].OrderUID = current.OrderUID
+	}
+	if len(next.Items) > 0 {
+		return tx.Create(&next.Items).Error
+	}
+	return nil
+}
+
+// change выполняет изменение заказа current в транзакции и записывает его в журнал.
+// Для журнала прежнее состояние читается под блокировкой строки заказа.
+func (r *GormRepository) change(current models.Order, apply func(tx *gorm.DB) error) error {
+	return translate(r.db.Transaction(func(tx *gorm.DB) error {
+		var previous *models.Order
+		if r.enabled() {
+			locked, err := lockedOrder(tx, current.OrderUID)
+			if errors.Is(err, ErrNotFound) {
+				return ErrConcurrentUpdate
+			}
+			if err != nil {
+				return err
+			}
+			if locked.Version != current.Version {
+				return ErrConcurrentUpdate
+			}
+			previous = &locked
+		}
+		if err := apply(tx); err != nil {
+			return err
+		}
+		return r.recordChange(tx, current.OrderUID, previous)
+	}))
+}
+
+// Cancel отмечает заказ отмененным
+func (r *GormRepository) Cancel(current models.Order, version int, at time.Time) error {
+	return r.change(current, func(tx *gorm.DB) error {
+		return bumpVersion(tx, current, version, map[string]interface{}{"cancelled_at": &at})
+	})
+}
+
+// SetItemStatus меняет статус позиции и версию заказа в одной транзакции
+func (r *GormRepository) SetItemStatus(current models.Order, version int, chrtID int, status int) error {
+	return r.change(current, func(tx *gorm.DB) error {
+		res := tx.Model(&models.Items{}).
+			Where("order_uid = ? AND chrt_id = ?", current.OrderUID, chrtID).
+			Update("status", status)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: %d", ErrItemNotFound, chrtID)
+		}
+		return bumpVersion(tx, current, version, nil)
+	})
+}
+
+// bumpVersion обновляет версию заказа и поля fields, если версия не изменилась с момента чтения
+func bumpVersion(tx *gorm.DB, current models.Order, version int, fields map[string]interface{}) error {
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	fields["version"] = version
+	res := tx.Model(&models.Order{}).Where("id = ? AND version = ?", current.ID, current.Version).Updates(fields)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrConcurrentUpdate
+	}
+	return nil
+}
+
+// Delete удаляет заказ из БД, доставку, оплату и позиции удаляет внешний ключ ON DELETE CASCADE.
+// Удаление не мягкое, чтобы заказ с тем же OrderUID можно было сохранить снова.
+func (r *GormRepository) Delete(orderUID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var previous *models.Order
+		if r.enabled() {
+			locked, err := lockedOrder(tx, orderUID)
+			if err != nil {
+				return err
+			}
+			previous = &locked
+		}
+		res := tx.Unscoped().Where("order_uid = ?", orderUID).Delete(&models.Order{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return r.record(tx, orderUID, previous, nil)
+	})
+}
+
+// ListPage возвращает страницу заказов после afterID, для постраничного обхода без OFFSET
+func (r *GormRepository) ListPage(afterID uint, limit int) ([]models.Order, error) {
+	var orders []models.Order
+	err := preloaded(r.db).Where("id > ?", afterID).Order("id").Limit(limit).Find(&orders).Error
+	return orders, err
+}
+
+// StreamAll читает заказы со связанными записями пачками через FindInBatches
+func (r *GormRepository) StreamAll(opts StreamOptions, fn func(orders []models.Order) error) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize < 1 {
+		chunkSize = DefaultChunkSize
+	}
+	query := r.db
+	if opts.Newest > 0 {
+		// Граница берется по индексу первичного ключа, без сортировки всей таблицы в памяти
+		var boundary []uint
+		err := r.db.Model(&models.Order{}).Order("id desc").Offset(opts.Newest-1).Limit(1).Pluck("id", &boundary).Error
+		if err != nil {
+			return err
+		}
+		if len(boundary) > 0 {
+			query = query.Where("id >= ?", boundary[0])
+		}
+	}
+	if !opts.UpdatedSince.IsZero() {
+		query = query.Where("updated_at >= ?", opts.UpdatedSince)
+	}
+
+	var orders []models.Order
+	return preloaded(query).FindInBatches(&orders, chunkSize, func(tx *gorm.DB, batch int) error {
+		return fn(orders)
+	}).Error
+}
+
+var (
+	_ OrderRepository = (*GormRepository)(nil)
+	_ Journaled       = (*GormRepository)(nil)
+	_ Attributed      = (*GormRepository)(nil)
+)
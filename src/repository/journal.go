@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"wild_project/src/models"
+)
+
+// ErrJournal изменение заказа не записано в журнал, поэтому не сохранено.
+// Ошибка дополняется причиной и не считается нарушением ограничений заказа.
+var ErrJournal = errors.New("изменение заказа не записано в журнал")
+
+// Journal журнал изменений заказов, например история заказа. Хранилище передает ему каждое
+// изменение в транзакции этого изменения: изменение и запись журнала сохраняются вместе
+// или не сохраняются вовсе.
+type Journal interface {
+	// Record записывает через tx изменение заказа orderUID из previous в current, приписанное
+	// источнику source. previous nil - заказ создан, current nil - заказ удален.
+	Record(tx *gorm.DB, orderUID string, source string, previous, current *models.Order) error
+}
+
+// Journaled хранилище, которое записывает изменения заказов в журнал
+type Journaled interface {
+	// WithJournal возвращает хранилище, которое записывает каждое изменение заказа в journal
+	WithJournal(journal Journal) OrderRepository
+}
+
+// WithJournal возвращает хранилище, которое записывает изменения через repo в journal.
+// Хранилище в памяти транзакций не имеет и журнал не поддерживает.
+func WithJournal(repo OrderRepository, journal Journal) (OrderRepository, error) {
+	journaled, ok := repo.(Journaled)
+	if !ok {
+		return nil, fmt.Errorf("хранилище %T не поддерживает журнал изменений", repo)
+	}
+	return journaled.WithJournal(journal), nil
+}
+
+// journaling журнал и источник изменений хранилища БД. Нулевое значение ничего не записывает.
+type journaling struct {
+	journal Journal
+	source  func(orderUID string) string
+}
+
+// enabled сообщает, записываются ли изменения, чтобы без журнала не читать прежнее состояние заказа
+func (j journaling) enabled() bool {
+	return j.journal != nil
+}
+
+// record записывает изменение заказа в журнал в транзакции tx
+func (j journaling) record(tx *gorm.DB, orderUID string, previous, current *models.Order) error {
+	if j.journal == nil {
+		return nil
+	}
+	source := ""
+	if j.source != nil {
+		source = j.source(orderUID)
+	}
+	// Причина передается текстом: ошибка БД журнала не должна выглядеть нарушением ограничений заказа
+	if err := j.journal.Record(tx, orderUID, source, previous, current); err != nil {
+		return fmt.Errorf("%w: %v", ErrJournal, err)
+	}
+	return nil
+}
+
+// forUpdate блокирует читаемые строки до конца транзакции, чтобы параллельное изменение заказа
+// дождалось записи в журнал и прочитало уже новое состояние. SQLite блокировку строк
+// не поддерживает и пропускает ее, транзакции в нем и так выполняются по одной.
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
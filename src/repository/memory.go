@@ -0,0 +1,362 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"wild_project/src/models"
+)
+
+// MemoryRepository реализация OrderRepository в памяти процесса для тестов.
+// Повторяет контракт GormRepository: идентификаторы записей, проверку версий и ошибки.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	orders map[string]models.Order
+	nextID uint
+	// Err, если задана, возвращается всеми методами, например чтобы проверить обработку сбоя БД
+	Err error
+}
+
+// NewMemoryRepository создает пустой MemoryRepository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{orders: make(map[string]models.Order)}
+}
+
+// copyOrder возвращает копию заказа, не разделяющую с ним позиции и время отмены
+func copyOrder(order models.Order) models.Order {
+	order.Items = append([]models.Items(nil), order.Items...)
+	if order.CancelledAt != nil {
+		cancelledAt := *order.CancelledAt
+		order.CancelledAt = &cancelledAt
+	}
+	return order
+}
+
+// setItemStatus меняет статус позиции chrtID заказа или возвращает ErrItemNotFound
+func setItemStatus(order *models.Order, chrtID int, status int) error {
+	found := false
+	for i := range order.Items {
+		if order.Items[i].ChrtID == chrtID {
+			order.Items[i].Status = status
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %d", ErrItemNotFound, chrtID)
+	}
+	return nil
+}
+
+// assignIDs заполняет идентификаторы и время записей, как это делает БД при вставке
+func (r *MemoryRepository) assignIDs(order *models.Order, now time.Time) {
+	next := func() uint {
+		r.nextID++
+		return r.nextID
+	}
+	if order.ID == 0 {
+		order.ID = next()
+		order.CreatedAt = now
+	}
+	order.UpdatedAt = now
+	if order.Delivery.ID == 0 {
+		order.Delivery.ID = next()
+		order.Delivery.CreatedAt = now
+	}
+	order.Delivery.UpdatedAt = now
+	order.Delivery.OrderUID = order.OrderUID
+	if order.Payment.ID == 0 {
+		order.Payment.ID = next()
+		order.Payment.CreatedAt = now
+	}
+	order.Payment.UpdatedAt = now
+	order.Payment.OrderUID = order.OrderUID
+	for i := range order.Items {
+		order.Items[i].ID = next()
+		order.Items[i].CreatedAt = now
+		order.Items[i].UpdatedAt = now
+		order.Items[i].OrderUID = order.OrderUID
+	}
+}
+
+// sorted возвращает копии заказов в порядке id, отобранные функцией keep
+func (r *MemoryRepository) sorted(keep func(order models.Order) bool) []models.Order {
+	var orders []models.Order
+	for _, order := range r.orders {
+		if keep(order) {
+			orders = append(orders, copyOrder(order))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders
+}
+
+// GetByUID возвращает копию заказа
+func (r *MemoryRepository) GetByUID(orderUID string) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return models.Order{}, r.Err
+	}
+	order, exists := r.orders[orderUID]
+	if !exists {
+		return models.Order{}, ErrNotFound
+	}
+	return copyOrder(order), nil
+}
+
+// GetByUIDs возвращает копии найденных заказов в порядке id
+func (r *MemoryRepository) GetByUIDs(orderUIDs []string) ([]models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	wanted := make(map[string]bool, len(orderUIDs))
+	for _, uid := range orderUIDs {
+		wanted[uid] = true
+	}
+	return r.sorted(func(order models.Order) bool { return wanted[order.OrderUID] }), nil
+}
+
+// ExistingUIDs возвращает OrderUID из списка, которые есть в хранилище
+func (r *MemoryRepository) ExistingUIDs(orderUIDs []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	var uids []string
+	for _, uid := range orderUIDs {
+		if _, exists := r.orders[uid]; exists {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, nil
+}
+
+// FindBy возвращает копии заказов с заданным значением поля
+func (r *MemoryRepository) FindBy(field string, value string) ([]models.Order, error) {
+	var keep func(order models.Order) bool
+	switch field {
+	case FieldTrackNumber:
+		keep = func(order models.Order) bool { return order.TrackNumber == value }
+	case FieldCustomerID:
+		keep = func(order models.Order) bool { return order.CustomerID == value }
+	case FieldTransaction:
+		keep = func(order models.Order) bool { return order.Payment.Transaction == value }
+	case FieldRID:
+		keep = func(order models.Order) bool {
+			for _, item := range order.Items {
+				if item.RID == value {
+					return true
+				}
+			}
+			return false
+		}
+	default:
+		return nil, fmt.Errorf("поиск по полю %s не поддерживается", field)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return r.sorted(keep), nil
+}
+
+// Create сохраняет новый заказ и проверяет те же ограничения, что и схема БД
+func (r *MemoryRepository) Create(order *models.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.create(order)
+}
+
+func (r *MemoryRepository) create(order *models.Order) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if _, exists := r.orders[order.OrderUID]; exists {
+		return ErrDuplicateOrder
+	}
+	if err := r.checkOrder(*order); err != nil {
+		return err
+	}
+	r.assignIDs(order, time.Now())
+	r.orders[order.OrderUID] = copyOrder(*order)
+	return nil
+}
+
+// CreateBatch сохраняет заказы, при ошибке не сохраняется ни один
+func (r *MemoryRepository) CreateBatch(orders []models.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[string]bool, len(orders))
+	for _, order := range orders {
+		if _, exists := r.orders[order.OrderUID]; exists || seen[order.OrderUID] {
+			return ErrDuplicateOrder
+		}
+		seen[order.OrderUID] = true
+		if err := r.checkOrder(order); err != nil {
+			return err
+		}
+	}
+	for i := range orders {
+		for j := range orders[:i] {
+			if orders[i].Payment.Transaction != "" && orders[i].Payment.Transaction == orders[j].Payment.Transaction {
+				return ErrDuplicateTransaction
+			}
+		}
+	}
+	for i := range orders {
+		if err := r.create(&orders[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Upsert создает заказ или заменяет сохраненный заказ более новой версией
+func (r *MemoryRepository) Upsert(order *models.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, exists := r.orders[order.OrderUID]
+	if !exists {
+		return r.create(order)
+	}
+	if r.Err != nil {
+		return r.Err
+	}
+	if order.Version <= current.Version {
+		return ErrConcurrentUpdate
+	}
+	if err := r.checkOrder(*order); err != nil {
+		return err
+	}
+	order.Model = current.Model
+	order.Delivery.Model = current.Delivery.Model
+	order.Payment.Model = current.Payment.Model
+	// Отмена не входит в заменяемые поля
+	order.CancelledAt = current.CancelledAt
+	r.assignIDs(order, time.Now())
+	r.orders[order.OrderUID] = copyOrder(*order)
+	return nil
+}
+
+// checkOrder проверяет CHECK ограничения и уникальность транзакции оплаты среди других заказов
+func (r *MemoryRepository) checkOrder(order models.Order) error {
+	if err := checkConstraints(order); err != nil {
+		return err
+	}
+	if order.Payment.Transaction == "" {
+		return nil
+	}
+	for uid, stored := range r.orders {
+		if uid != order.OrderUID && stored.Payment.Transaction == order.Payment.Transaction {
+			return ErrDuplicateTransaction
+		}
+	}
+	return nil
+}
+
+// update применяет change к сохраненному заказу, если его версия не изменилась после чтения current
+func (r *MemoryRepository) update(current models.Order, version int, change func(order *models.Order) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return r.Err
+	}
+	order, exists := r.orders[current.OrderUID]
+	if !exists || order.Version != current.Version {
+		return ErrConcurrentUpdate
+	}
+	order = copyOrder(order)
+	if err := change(&order); err != nil {
+		return err
+	}
+	order.Version = version
+	order.UpdatedAt = time.Now()
+	r.orders[order.OrderUID] = order
+	return nil
+}
+
+// Cancel отмечает заказ отмененным
+func (r *MemoryRepository) Cancel(current models.Order, version int, at time.Time) error {
+	return r.update(current, version, func(order *models.Order) error {
+		order.CancelledAt = &at
+		return nil
+	})
+}
+
+// SetItemStatus меняет статус позиции
+func (r *MemoryRepository) SetItemStatus(current models.Order, version int, chrtID int, status int) error {
+	return r.update(current, version, func(order *models.Order) error {
+		return setItemStatus(order, chrtID, status)
+	})
+}
+
+// Delete удаляет заказ
+func (r *MemoryRepository) Delete(orderUID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return r.Err
+	}
+	if _, exists := r.orders[orderUID]; !exists {
+		return ErrNotFound
+	}
+	delete(r.orders, orderUID)
+	return nil
+}
+
+// ListPage возвращает страницу заказов после afterID
+func (r *MemoryRepository) ListPage(afterID uint, limit int) ([]models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	orders := r.sorted(func(order models.Order) bool { return order.ID > afterID })
+	if limit >= 0 && len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+// StreamAll передает заказы в fn пачками. Заказы копируются до вызова fn, поэтому fn может
+// обращаться к хранилищу.
+func (r *MemoryRepository) StreamAll(opts StreamOptions, fn func(orders []models.Order) error) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize < 1 {
+		chunkSize = DefaultChunkSize
+	}
+	r.mu.Lock()
+	if r.Err != nil {
+		r.mu.Unlock()
+		return r.Err
+	}
+	all := r.sorted(func(models.Order) bool { return true })
+	r.mu.Unlock()
+	if opts.Newest > 0 && len(all) > opts.Newest {
+		all = all[len(all)-opts.Newest:]
+	}
+	var orders []models.Order
+	for _, order := range all {
+		if opts.UpdatedSince.IsZero() || !order.UpdatedAt.Before(opts.UpdatedSince) {
+			orders = append(orders, order)
+		}
+	}
+
+	for start := 0; start < len(orders); start += chunkSize {
+		end := start + chunkSize
+		if end > len(orders) {
+			end = len(orders)
+		}
+		if err := fn(orders[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ OrderRepository = (*MemoryRepository)(nil)
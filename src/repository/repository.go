@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"wild_project/src/models"
+)
+
+// DefaultChunkSize размер пачки заказов при чтении больших таблиц
+const DefaultChunkSize = 1000
+
+// Способы хранения заказов в БД
+const (
+	BackendRelational = "relational" // Таблицы orders, deliveries, payments и items, по умолчанию
+	BackendDocument   = "document"   // Заказ целиком JSONB документом в таблице order_documents
+)
+
+// Поля, по которым FindBy ищет заказы
+const (
+	FieldTrackNumber = "track_number"
+	FieldCustomerID  = "customer_id"
+	FieldTransaction = "transaction" // Payment.Transaction
+	FieldRID         = "rid"         // RID позиции заказа
+)
+
+var (
+	// ErrNotFound заказа нет в хранилище
+	ErrNotFound = errors.New("заказ не найден")
+	// ErrConcurrentUpdate заказ изменился после чтения, изменение нужно повторить
+	ErrConcurrentUpdate = errors.New("заказ изменен параллельно")
+	// ErrDuplicateOrder заказ с таким OrderUID уже сохранен
+	ErrDuplicateOrder = errors.New("заказ с таким OrderUID уже сохранен")
+	// ErrDuplicateTransaction транзакция оплаты уже принадлежит другому заказу
+	ErrDuplicateTransaction = errors.New("транзакция оплаты уже принадлежит другому заказу")
+	// ErrConstraintViolation заказ нарушает ограничение схемы, например отрицательная цена.
+	// Ошибка дополняется именем ограничения.
+	ErrConstraintViolation = errors.New("заказ нарушает ограничение схемы")
+	// ErrItemNotFound в заказе нет позиции с указанным ChrtID
+	ErrItemNotFound = errors.New("позиция заказа не найдена")
+)
+
+// StreamOptions отбор заказов для StreamAll. Нулевые значения снимают соответствующее условие.
+type StreamOptions struct {
+	ChunkSize    int       // Размер пачки, по умолчанию DefaultChunkSize
+	Newest       int       // Только последние Newest заказов по id
+	UpdatedSince time.Time // Только заказы, измененные не раньше этого времени
+}
+
+// OrderRepository хранилище заказов вместе с доставкой, оплатой и позициями.
+// Обработчики HTTP, кэш и прием сообщений работают с заказами только через него.
+type OrderRepository interface {
+	// GetByUID возвращает заказ по OrderUID или ErrNotFound
+	GetByUID(orderUID string) (models.Order, error)
+	// GetByUIDs возвращает найденные заказы из списка, отсутствующие пропускаются
+	GetByUIDs(orderUIDs []string) ([]models.Order, error)
+	// ExistingUIDs возвращает OrderUID из списка, заказы с которыми есть в хранилище, не загружая сами заказы
+	ExistingUIDs(orderUIDs []string) ([]string, error)
+	// FindBy возвращает заказы с заданным значением поля Field* в порядке id
+	FindBy(field string, value string) ([]models.Order, error)
+	// Create сохраняет новый заказ в одной транзакции и заполняет идентификаторы записей
+	Create(order *models.Order) error
+	// CreateBatch сохраняет новые заказы в одной транзакции и заполняет идентификаторы записей
+	CreateBatch(orders []models.Order) error
+	// Upsert сохраняет заказ, если заказа с таким OrderUID нет, иначе заменяет сохраненный заказ
+	// вместе с доставкой, оплатой и позициями. Замена выполняется, только если версия order больше
+	// сохраненной, иначе возвращается ErrConcurrentUpdate.
+	Upsert(order *models.Order) error
+	// Cancel отмечает заказ current отмененным и переводит его на версию version.
+	// Возвращает ErrConcurrentUpdate, если версия заказа изменилась после чтения current.
+	Cancel(current models.Order, version int, at time.Time) error
+	// SetItemStatus меняет статус позиции chrtID заказа current и переводит его на версию version.
+	// Возвращает ErrConcurrentUpdate, если версия заказа изменилась после чтения current.
+	SetItemStatus(current models.Order, version int, chrtID int, status int) error
+	// Delete удаляет заказ вместе с доставкой, оплатой и позициями или возвращает ErrNotFound
+	Delete(orderUID string) error
+	// ListPage возвращает до limit заказов с id больше afterID в порядке id
+	ListPage(afterID uint, limit int) ([]models.Order, error)
+	// StreamAll читает заказы пачками в порядке id и передает каждую пачку в fn.
+	// Срез может переиспользоваться между пачками, fn не должна его сохранять.
+	StreamAll(opts StreamOptions, fn func(orders []models.Order) error) error
+}
+
+// New создает хранилище заказов со способом хранения backend поверх подключения db
+func New(backend string, db *gorm.DB) (OrderRepository, error) {
+	switch backend {
+	case BackendRelational, "":
+		return NewGormRepository(db), nil
+	case BackendDocument:
+		return NewDocumentRepository(db), nil
+	default:
+		return nil, fmt.Errorf("неизвестный способ хранения заказов: %s", backend)
+	}
+}
+
+// Attributed хранилище, которое запоминает источник каждого изменения заказа, например для истории заказа
+type Attributed interface {
+	// WithSource возвращает хранилище, которое приписывает изменение заказа источнику source(orderUID)
+	WithSource(source func(orderUID string) string) OrderRepository
+}
+
+// WithSource приписывает изменения через repo источнику source, если хранилище запоминает источники
+func WithSource(repo OrderRepository, source string) OrderRepository {
+	return withSource(repo, func(string) string { return source })
+}
+
+// WithSources приписывает изменения пачки заказов источникам из sources по OrderUID
+func WithSources(repo OrderRepository, sources map[string]string) OrderRepository {
+	return withSource(repo, func(orderUID string) string { return sources[orderUID] })
+}
+
+func withSource(repo OrderRepository, source func(orderUID string) string) OrderRepository {
+	if attributed, ok := repo.(Attributed); ok {
+		return attributed.WithSource(source)
+	}
+	return repo
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"wild_project/src/models"
+	"wild_project/src/tests/testdb"
+)
+
+// forEachRepository запускает тест для каждой реализации хранилища, чтобы они выполняли один контракт
+func forEachRepository(t *testing.T, test func(t *testing.T, repo OrderRepository)) {
+	t.Run("gorm", func(t *testing.T) { test(t, NewGormRepository(testdb.Open(t))) })
+	t.Run("document", func(t *testing.T) { test(t, NewDocumentRepository(testdb.Open(t))) })
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryRepository()) })
+}
+
+// createOrders сохраняет count заказов order-0, order-1, ... с доставкой, оплатой и двумя позициями
+func createOrders(t *testing.T, repo OrderRepository, count int) {
+	for i := 0; i < count; i++ {
+		order := models.Order{
+			OrderUID: fmt.Sprintf("order-%d", i),
+			Delivery: models.Delivery{City: "Moscow"},
+			Payment:  models.Payment{Transaction: fmt.Sprintf("tx-%d", i)},
+			Items:    []models.Items{{ChrtID: 1, RID: fmt.Sprintf("rid-%d", i)}, {ChrtID: 2}},
+		}
+		assert.NoError(t, repo.Create(&order))
+	}
+}
+
+func TestStreamAllInChunks(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo OrderRepository) {
+		assert := assert.New(t)
+		createOrders(t, repo, 7)
+
+		var chunks []int
+		var uids []string
+		err := repo.StreamAll(StreamOptions{ChunkSize: 3}, func(orders []models.Order) error {
+			chunks = append(chunks, len(orders))
+			for _, order := range orders {
+				uids = append(uids, order.OrderUID)
+				assert.Equal("Moscow", order.Delivery.City)
+				assert.Equal("tx"+order.OrderUID[len("order"):], order.Payment.Transaction)
+				assert.Len(order.Items, 2)
+			}
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal([]int{3, 3, 1}, chunks)
+		assert.Len(uids, 7)
+		assert.Equal("order-0", uids[0])
+
+		// Только последние заказы
+		uids = nil
+		err = repo.StreamAll(StreamOptions{Newest: 2}, func(orders []models.Order) error {
+			for _, order := range orders {
+				uids = append(uids, order.OrderUID)
+			}
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal([]string{"order-5", "order-6"}, uids)
+
+		order, err := repo.GetByUID("order-4")
+		assert.NoError(err)
+		assert.Equal("tx-4", order.Payment.Transaction)
+		assert.Equal(1, order.Items[0].ChrtID)
+		_, err = repo.GetByUID("missing")
+		assert.ErrorIs(err, ErrNotFound)
+	})
+}
+
+func TestRepositoryQueries(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo OrderRepository) {
+		assert := assert.New(t)
+		createOrders(t, repo, 5)
+
+		orders, err := repo.GetByUIDs([]string{"order-3", "missing", "order-1"})
+		assert.NoError(err)
+		if assert.Len(orders, 2) {
+			assert.Equal("order-1", orders[0].OrderUID)
+			assert.Len(orders[1].Items, 2)
+		}
+
+		orders, err = repo.FindBy(FieldRID, "rid-2")
+		assert.NoError(err)
+		if assert.Len(orders, 1) {
+			assert.Equal("order-2", orders[0].OrderUID)
+			assert.Len(orders[0].Items, 2)
+		}
+		orders, err = repo.FindBy(FieldTransaction, "tx-4")
+		assert.NoError(err)
+		assert.Len(orders, 1)
+		_, err = repo.FindBy("entry", "x")
+		assert.Error(err)
+
+		page, err := repo.ListPage(0, 2)
+		assert.NoError(err)
+		if assert.Len(page, 2) {
+			page, err = repo.ListPage(page[1].ID, 10)
+			assert.NoError(err)
+			assert.Len(page, 3)
+		}
+
+		assert.NoError(repo.Delete("order-0"))
+		assert.ErrorIs(repo.Delete("order-0"), ErrNotFound)
+	})
+}
+
+func TestRepositoryVersionedUpdates(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo OrderRepository) {
+		assert := assert.New(t)
+
+		// Upsert создает отсутствующий заказ
+		order := models.Order{OrderUID: "a", Version: 1, Items: []models.Items{{ChrtID: 1}}}
+		assert.NoError(repo.Upsert(&order))
+
+		next := models.Order{OrderUID: "a", Version: 2, TrackNumber: "UPDATED",
+			Delivery: models.Delivery{City: "Kazan"}, Items: []models.Items{{ChrtID: 2}, {ChrtID: 3}}}
+		assert.NoError(repo.Upsert(&next))
+		assert.Equal(order.ID, next.ID)
+		stale := models.Order{OrderUID: "a", Version: 2}
+		assert.ErrorIs(repo.Upsert(&stale), ErrConcurrentUpdate)
+
+		current, err := repo.GetByUID("a")
+		assert.NoError(err)
+		assert.Equal("UPDATED", current.TrackNumber)
+		assert.Equal("Kazan", current.Delivery.City)
+		assert.Len(current.Items, 2)
+
+		assert.NoError(repo.SetItemStatus(current, 3, 3, 7))
+		// Версия current устарела после изменения статуса
+		assert.ErrorIs(repo.Cancel(current, 4, time.Now()), ErrConcurrentUpdate)
+		current, _ = repo.GetByUID("a")
+		assert.Equal(7, current.Items[1].Status)
+		assert.NoError(repo.Cancel(current, 4, time.Now()))
+
+		current, _ = repo.GetByUID("a")
+		assert.Equal(4, current.Version)
+		assert.NotNil(current.CancelledAt)
+	})
+}
+
+func TestExistingUIDs(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo OrderRepository) {
+		assert := assert.New(t)
+		createOrders(t, repo, 3)
+		assert.NoError(repo.Delete("order-1"))
+
+		uids, err := repo.ExistingUIDs([]string{"order-0", "order-1", "order-2", "missing"})
+		assert.NoError(err)
+		assert.ElementsMatch([]string{"order-0", "order-2"}, uids)
+		uids, err = repo.ExistingUIDs(nil)
+		assert.NoError(err)
+		assert.Empty(uids)
+	})
+}
+
+func TestSetItemStatusUnknownItem(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo OrderRepository) {
+		assert := assert.New(t)
+		order := models.Order{OrderUID: "a", Version: 1, Items: []models.Items{{ChrtID: 1}}}
+		assert.NoError(repo.Create(&order))
+
+		// Изменение статуса несуществующей позиции не меняет заказ и его версию
+		assert.ErrorIs(repo.SetItemStatus(order, 2, 99, 7), ErrItemNotFound)
+		current, err := repo.GetByUID("a")
+		assert.NoError(err)
+		assert.Equal(1, current.Version)
+		assert.Equal(0, current.Items[0].Status)
+	})
+}
+
+func TestRepositoryConstraints(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo OrderRepository) {
+		assert := assert.New(t)
+		createOrders(t, repo, 2)
+
+		duplicate := models.Order{OrderUID: "order-1"}
+		assert.ErrorIs(repo.Create(&duplicate), ErrDuplicateOrder)
+
+		order := models.Order{OrderUID: "order-x", Payment: models.Payment{Transaction: "tx-0"}}
+		assert.ErrorIs(repo.Create(&order), ErrDuplicateTransaction)
+		// Пустая транзакция может быть у нескольких заказов
+		order = models.Order{OrderUID: "order-x"}
+		assert.NoError(repo.Create(&order))
+		order = models.Order{OrderUID: "order-y"}
+		assert.NoError(repo.Create(&order))
+
+		order = models.Order{OrderUID: "order-z", Items: []models.Items{{ChrtID: 1, Price: -1}}}
+		assert.ErrorIs(repo.Create(&order), ErrConstraintViolation)
+		order = models.Order{OrderUID: "order-z", Payment: models.Payment{Amount: -5}}
+		assert.ErrorIs(repo.Create(&order), ErrConstraintViolation)
+		order = models.Order{OrderUID: "order-z", Items: []models.Items{{Sale: 101}}}
+		assert.ErrorIs(repo.Create(&order), ErrConstraintViolation)
+		order = models.Order{}
+		assert.ErrorIs(repo.Create(&order), ErrConstraintViolation)
+		_, err := repo.GetByUID("order-z")
+		assert.ErrorIs(err, ErrNotFound)
+
+		// Пачка с нарушением не сохраняется целиком
+		batch := []models.Order{{OrderUID: "order-b1"}, {OrderUID: "order-b2", Payment: models.Payment{Transaction: "tx-1"}}}
+		assert.ErrorIs(repo.CreateBatch(batch), ErrDuplicateTransaction)
+		orders, err := repo.GetByUIDs([]string{"order-b1", "order-b2"})
+		assert.NoError(err)
+		assert.Empty(orders)
+
+		// Заменить заказ на нарушающий ограничения нельзя
+		next := models.Order{OrderUID: "order-0", Version: 1, Payment: models.Payment{Transaction: "tx-1"}}
+		assert.ErrorIs(repo.Upsert(&next), ErrDuplicateTransaction)
+	})
+}
+
+func TestDeleteCascades(t *testing.T) {
+	db := testdb.Open(t)
+	repo := NewGormRepository(db)
+	createOrders(t, repo, 2)
+
+	assert.NoError(t, repo.Delete("order-0"))
+	for _, related := range []interface{}{&models.Delivery{}, &models.Payment{}, &models.Items{}} {
+		var count int64
+		db.Unscoped().Model(related).Where("order_uid = ?", "order-0").Count(&count)
+		assert.Zero(t, count, "связанные записи удаляются вместе с заказом")
+	}
+	// Заказ с тем же OrderUID можно сохранить снова
+	createOrders(t, repo, 1)
+}
@@ -0,0 +1,58 @@
+package testdb
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"path/filepath"
+	"testing"
+	"wild_project/src/models"
+)
+
+// orderDocumentsDDL таблица хранилища документов, как в миграции 0003_order_documents,
+// с функциями json SQLite вместо операторов JSONB и без GIN индекса
+const orderDocumentsDDL = `
+CREATE TABLE order_documents (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at   DATETIME NOT NULL,
+    updated_at   DATETIME NOT NULL,
+    document     TEXT NOT NULL,
+    order_uid    TEXT GENERATED ALWAYS AS (document ->> '$.OrderUID') STORED NOT NULL,
+    track_number TEXT GENERATED ALWAYS AS (document ->> '$.TrackNumber') STORED,
+    customer_id  TEXT GENERATED ALWAYS AS (document ->> '$.CustomerID') STORED,
+    date_created TEXT GENERATED ALWAYS AS (document ->> '$.DateCreated') STORED,
+    version      INTEGER GENERATED ALWAYS AS (document ->> '$.Version') STORED NOT NULL
+);
+CREATE UNIQUE INDEX idx_order_documents_order_uid ON order_documents (order_uid);
+CREATE INDEX idx_order_documents_track_number ON order_documents (track_number);
+CREATE INDEX idx_order_documents_customer_id ON order_documents (customer_id);
+CREATE INDEX idx_order_documents_date_created ON order_documents (date_created);
+CREATE UNIQUE INDEX idx_order_documents_transaction ON order_documents ((document ->> '$.payment.Transaction'))
+    WHERE (document ->> '$.payment.Transaction') <> '';
+`
+
+// Open создает временную БД SQLite с мигрированными моделями, чтобы тесты не зависели от PostgreSQL.
+// Миграции из src/migrations написаны для PostgreSQL, поэтому схема создается через AutoMigrate.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	// Внешние ключи в SQLite проверяются, только если включены для соединения
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	err = db.AutoMigrate(&models.Order{}, &models.Delivery{}, &models.Payment{}, &models.Items{}, &models.QuarantinedMessage{}, &models.OrderHistory{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	if err := db.Exec(orderDocumentsDDL).Error; err != nil {
+		t.Fatalf("Failed to create order_documents: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
@@ -3,13 +3,16 @@ package utils
 import (
 	"encoding/json"
 	"errors"
-	"github.com/nats-io/stan.go"
+	"fmt"
 	"gopkg.in/natefinch/lumberjack.v2"
-	"gorm.io/gorm"
 	"log"
+	"time"
 	"wild_project/src/cache"
+	"wild_project/src/deadletter"
+	"wild_project/src/history"
 	"wild_project/src/models"
 	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
 )
 
 // DeserializeOrder преобразует JSON-строку в структуру Order
@@ -28,6 +31,9 @@ const (
 	ErrMissingTrackNumber = "отсутствует Order track number"
 )
 
+// ErrInvalidOrder означает, что сообщение не может быть обработано и повторная доставка не поможет
+var ErrInvalidOrder = errors.New("некорректный заказ")
+
 // ValidateOrder пример валидации полей
 func ValidateOrder(order *models.Order) error {
 	if order.OrderUID == "" {
@@ -53,48 +59,125 @@ func init() {
 	}, "NATS_HANDLER: ", log.Ldate|log.Ltime|log.Lshortfile)
 }
 
-func SubscribeToNats(client *natsclient.NatsClient, orderCache *cache.OrderCache, db *gorm.DB, channelName string) {
-	err := client.Subscribe(channelName, func(m *stan.Msg) {
-		logger.Printf("Получено новое сообщение: %s\n", string(m.Data))
-		ProcessNatsMessage(orderCache, db, m)
-	})
+func SubscribeToNats(client natsclient.Broker, orderCache cache.Cache, repo repository.OrderRepository, dlq *deadletter.Queue, channelName string, ackWait time.Duration) {
+	err := client.Subscribe(channelName, NewOrderHandler(orderCache, repo, dlq), natsclient.AckWait(ackWait))
 
 	if err != nil {
 		logger.Fatalf("Ошибка при подписке на канал NATS: %v", err)
 	}
 }
 
-func ProcessNatsMessage(orderCache *cache.OrderCache, db *gorm.DB, m *stan.Msg) {
+// NewOrderHandler возвращает обработчик заказов, который отправляет в карантин некорректные сообщения
+// и сообщения, исчерпавшие лимит повторных доставок
+func NewOrderHandler(orderCache cache.Cache, repo repository.OrderRepository, dlq *deadletter.Queue) natsclient.Handler {
+	return func(m *natsclient.Message) error {
+		logger.Printf("Получено новое сообщение: %s\n", string(m.Data))
+
+		err := ProcessNatsMessage(orderCache, repo, m)
+		if err == nil {
+			return nil
+		}
+		if !shouldQuarantine(err, m.RedeliveryCount, dlq.MaxRedeliveries) {
+			return err
+		}
+		return dlq.Put(m, err)
+	}
+}
+
+// shouldQuarantine определяет, нужно ли отправить сообщение в карантин вместо повторной доставки
+func shouldQuarantine(err error, redeliveryCount uint32, maxRedeliveries uint32) bool {
+	return errors.Is(err, ErrInvalidOrder) || redeliveryCount >= maxRedeliveries
+}
+
+// Result итог обработки сообщения с заказом
+type Result int
+
+const (
+	ResultInserted  Result = iota // Заказ сохранен в БД и кэш
+	ResultDuplicate               // Заказ уже был сохранен ранее
+	ResultRejected                // Сообщение не содержит корректного заказа
+	ResultFailed                  // Временная ошибка, сообщение нужно доставить повторно
+	ResultUpdated                 // Событие изменения применено к заказу
+	ResultStale                   // Версия события не новее сохраненной, событие отброшено
+)
+
+// ProcessNatsMessage применяет событие заказа из сообщения к БД и кэшу.
+// Возвращает ошибку, если заказ не был надежно сохранен и сообщение нужно доставить повторно.
+func ProcessNatsMessage(orderCache cache.Cache, repo repository.OrderRepository, m *natsclient.Message) error {
+	_, err := ProcessOrder(orderCache, repo, m, false)
+	if err == nil {
+		orderCache.MarkApplied(m.Sequence)
+	}
+	return err
+}
+
+// ProcessOrder обрабатывает сообщение с событием заказа и возвращает итог обработки.
+// В режиме dryRun событие только проверяется, в БД и кэш ничего не записывается.
+func ProcessOrder(orderCache cache.Cache, repo repository.OrderRepository, m *natsclient.Message, dryRun bool) (Result, error) {
+	// Изменения заказа в истории приписываются сообщению
+	repo = repository.WithSource(repo, history.NATSSource(m.Sequence))
+
 	// Десериализация сообщения
-	order, err := DeserializeOrder(string(m.Data))
+	event, err := DecodeEvent(m.Data)
 	if err != nil {
-		logger.Printf("Ошибка десериализации заказа: %v", err)
-		return
+		logger.Printf("Ошибка десериализации события: %v", err)
+		return ResultRejected, fmt.Errorf("%w: %v", ErrInvalidOrder, err)
+	}
+	if err := ValidateEvent(&event); err != nil {
+		logger.Printf("Ошибка валидации события: %v", err)
+		return ResultRejected, fmt.Errorf("%w: %v", ErrInvalidOrder, err)
 	}
+	if event.Type != models.EventCreated {
+		return applyEvent(orderCache, repo, event, dryRun)
+	}
+	order := *event.Order
 
 	// Проверка наличия заказа в кэше
 	if _, exists := orderCache.Get(order.OrderUID); exists {
 		logger.Printf("Заказ уже есть в кэше: %v", order.OrderUID)
-		return
+		return ResultDuplicate, nil
 	}
 
 	// Проверка наличия заказа в БД
-	var dbOrder models.Order
-	if err := db.Where("order_uid = ?", order.OrderUID).First(&dbOrder).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// Заказа нет в БД, сохраняем его
-			if err := db.Create(&order).Error; err != nil {
-				logger.Printf("Ошибка при сохранении заказа в БД: %v", err)
-				return
-			}
-			orderCache.Add(order)
-			logger.Printf("Заказ добавлен в БД и кэш: %v", order.OrderUID)
-		} else {
+	dbOrder, err := repo.GetByUID(order.OrderUID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
 			logger.Printf("Ошибка при запросе к БД: %v", err)
+			return ResultFailed, err
+		}
+		if dryRun {
+			return ResultInserted, nil
 		}
-	} else {
-		// Заказ уже есть в БД, добавляем в кэш, если он отсутствует
+		// Заказа нет в БД, сохраняем его вместе со связанными записями в одной транзакции
+		if err := repo.Create(&order); err != nil {
+			logger.Printf("Ошибка при сохранении заказа в БД: %v", err)
+			if errors.Is(err, repository.ErrDuplicateOrder) {
+				// Заказ успела сохранить другая реплика, сообщение доставится повторно и станет дубликатом
+				return ResultFailed, err
+			}
+			return storeError(err)
+		}
+		orderCache.Add(order)
+		orderCache.Created([]models.Order{order})
+		logger.Printf("Заказ добавлен в БД и кэш: %v", order.OrderUID)
+		return ResultInserted, nil
+	}
+
+	// Заказ уже есть в БД, добавляем в кэш, если он отсутствует
+	if !dryRun {
 		orderCache.Add(dbOrder)
 		logger.Printf("Заказ из БД добавлен в кэш: %v", order.OrderUID)
 	}
+	return ResultDuplicate, nil
+}
+
+// storeError сопоставляет ошибку записи в хранилище с итогом обработки. Заказ, нарушающий
+// ограничения схемы, и событие для несуществующей позиции не применятся и при повторной доставке,
+// поэтому сообщение отклоняется.
+func storeError(err error) (Result, error) {
+	if errors.Is(err, repository.ErrDuplicateTransaction) || errors.Is(err, repository.ErrConstraintViolation) ||
+		errors.Is(err, repository.ErrItemNotFound) {
+		return ResultRejected, fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+	return ResultFailed, err
 }
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"wild_project/src/models"
@@ -101,3 +103,39 @@ func jsonEqual(a, b models.Order) bool {
 	}
 	return string(aJSON) == string(bJSON)
 }
+
+func TestShouldQuarantine(t *testing.T) {
+	testCases := []struct {
+		name            string
+		err             error
+		redeliveryCount uint32
+		want            bool
+	}{
+		{
+			name:            "Invalid order",
+			err:             fmt.Errorf("%w: %s", ErrInvalidOrder, ErrMissingOrderUID),
+			redeliveryCount: 0,
+			want:            true,
+		},
+		{
+			name:            "Transient error",
+			err:             errors.New("connection refused"),
+			redeliveryCount: 1,
+			want:            false,
+		},
+		{
+			name:            "Redelivery limit reached",
+			err:             errors.New("connection refused"),
+			redeliveryCount: 5,
+			want:            true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := shouldQuarantine(tc.err, tc.redeliveryCount, 5); got != tc.want {
+				t.Errorf("%s: получено %v, ожидалось %v", tc.name, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/models"
+	"wild_project/src/repository"
+)
+
+var (
+	// ErrOrderNotFound событие пришло раньше, чем заказ был создан, сообщение нужно доставить повторно
+	ErrOrderNotFound = errors.New("заказ для события не найден")
+	// ErrConcurrentUpdate заказ изменился во время применения события
+	ErrConcurrentUpdate = repository.ErrConcurrentUpdate
+)
+
+// DecodeEvent разбирает сообщение канала. Сообщение без поля Type - это заказ в старом формате,
+// он считается событием created.
+func DecodeEvent(data []byte) (models.OrderEvent, error) {
+	var event models.OrderEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return models.OrderEvent{}, err
+	}
+	if event.Type == "" {
+		order, err := DeserializeOrder(string(data))
+		if err != nil {
+			return models.OrderEvent{}, err
+		}
+		event = models.OrderEvent{Type: models.EventCreated, OrderUID: order.OrderUID, Version: order.Version, Order: &order}
+	}
+	if event.Order != nil && event.OrderUID == "" {
+		event.OrderUID = event.Order.OrderUID
+	}
+	if event.Version == 0 {
+		event.Version = 1
+	}
+	return event, nil
+}
+
+// ValidateEvent проверяет, что событие содержит все нужные для его типа данные
+func ValidateEvent(event *models.OrderEvent) error {
+	if event.OrderUID == "" {
+		return errors.New(ErrMissingOrderUID)
+	}
+	switch event.Type {
+	case models.EventCreated, models.EventUpdated:
+		if event.Order == nil {
+			return fmt.Errorf("событие %s без заказа", event.Type)
+		}
+		if event.Order.OrderUID != event.OrderUID {
+			return fmt.Errorf("OrderUID события %s не совпадает с заказом %s", event.OrderUID, event.Order.OrderUID)
+		}
+		event.Order.Version = event.Version
+		return ValidateOrder(event.Order)
+	case models.EventCancelled:
+		return nil
+	case models.EventItemStatusChanged:
+		if event.Item == nil {
+			return errors.New("событие item_status_changed без позиции")
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестный тип события: %s", event.Type)
+	}
+}
+
+// applyEvent применяет событие изменения к существующему заказу в одной транзакции и обновляет кэш
+func applyEvent(orderCache cache.Cache, repo repository.OrderRepository, event models.OrderEvent, dryRun bool) (Result, error) {
+	current, err := repo.GetByUID(event.OrderUID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ResultFailed, fmt.Errorf("%w: %s", ErrOrderNotFound, event.OrderUID)
+		}
+		return ResultFailed, err
+	}
+	if event.Version <= current.Version {
+		logger.Printf("Устаревшее событие %s заказа %s: версия %d, сохранена %d", event.Type, event.OrderUID, event.Version, current.Version)
+		// В кэше может быть более старая версия, например после загрузки снимка
+		if cached, exists := orderCache.Get(event.OrderUID); !dryRun && (!exists || cached.Version < current.Version) {
+			orderCache.Add(current)
+		}
+		return ResultStale, nil
+	}
+	if dryRun {
+		return ResultUpdated, nil
+	}
+
+	switch event.Type {
+	case models.EventUpdated:
+		err = repo.Upsert(event.Order)
+	case models.EventCancelled:
+		err = repo.Cancel(current, event.Version, time.Now())
+	case models.EventItemStatusChanged:
+		err = repo.SetItemStatus(current, event.Version, event.Item.ChrtID, event.Item.Status)
+	}
+	if err != nil {
+		logger.Printf("Ошибка применения события %s заказа %s: %v", event.Type, event.OrderUID, err)
+		return storeError(err)
+	}
+
+	updated, err := repo.GetByUID(event.OrderUID)
+	if err != nil {
+		return ResultFailed, err
+	}
+	orderCache.Update(updated)
+	logger.Printf("Событие %s применено к заказу %s, версия %d", event.Type, event.OrderUID, event.Version)
+	return ResultUpdated, nil
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"wild_project/src/cache"
+	"wild_project/src/history"
+	"wild_project/src/models"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
+	"wild_project/src/tests"
+	"wild_project/src/tests/testdb"
+)
+
+// eventMessage упаковывает событие в сообщение брокера
+func eventMessage(t *testing.T, event models.OrderEvent) *natsclient.Message {
+	data, err := json.Marshal(event)
+	assert.NoError(t, err)
+	return &natsclient.Message{Data: data}
+}
+
+func TestProcessOrderEvents(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	orderCache := cache.NewOrderCache()
+
+	// Заказ в старом формате считается событием created с версией 1
+	messages, err := tests.GenerateTestMessages(1)
+	assert.NoError(err)
+	result, err := ProcessOrder(orderCache, repo, &natsclient.Message{Data: []byte(messages[0])}, false)
+	assert.NoError(err)
+	assert.Equal(ResultInserted, result)
+	uid := "b563feb7b2b84b6test0"
+
+	order, _ := orderCache.Get(uid)
+	assert.Equal(1, order.Version)
+
+	// updated заменяет поля заказа, доставку, оплату и позиции
+	order.TrackNumber = "UPDATED"
+	order.Delivery.City = "Moscow"
+	order.Payment.Amount = 500
+	order.Items = []models.Items{{ChrtID: 1, Status: 1}, {ChrtID: 2, Status: 1}}
+	result, err = ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{
+		Type: models.EventUpdated, Version: 2, Order: &order,
+	}), false)
+	assert.NoError(err)
+	assert.Equal(ResultUpdated, result)
+
+	stored, err := repo.GetByUID(uid)
+	assert.NoError(err)
+	assert.Equal("UPDATED", stored.TrackNumber)
+	assert.Equal("Moscow", stored.Delivery.City)
+	assert.Equal(500, stored.Payment.Amount)
+	assert.Len(stored.Items, 2)
+	var deliveries int64
+	db.Model(&models.Delivery{}).Count(&deliveries)
+	assert.Equal(int64(1), deliveries, "доставка обновляется на месте")
+
+	// item_status_changed меняет статус одной позиции
+	result, err = ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{
+		Type: models.EventItemStatusChanged, OrderUID: uid, Version: 3,
+		Item: &models.ItemStatusChange{ChrtID: 2, Status: 7},
+	}), false)
+	assert.NoError(err)
+	assert.Equal(ResultUpdated, result)
+
+	// Устаревшее событие отбрасывается без ошибки
+	result, err = ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{
+		Type: models.EventCancelled, OrderUID: uid, Version: 3,
+	}), false)
+	assert.NoError(err)
+	assert.Equal(ResultStale, result)
+
+	result, err = ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{
+		Type: models.EventCancelled, OrderUID: uid, Version: 4,
+	}), false)
+	assert.NoError(err)
+	assert.Equal(ResultUpdated, result)
+
+	cached, exists := orderCache.Get(uid)
+	assert.True(exists)
+	assert.Equal(4, cached.Version)
+	assert.NotNil(cached.CancelledAt)
+	assert.Equal("UPDATED", cached.TrackNumber)
+	for _, item := range cached.Items {
+		if item.ChrtID == 2 {
+			assert.Equal(7, item.Status)
+		} else {
+			assert.Equal(1, item.Status)
+		}
+	}
+}
+
+func TestProcessOrderEventErrors(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	orderCache := cache.NewOrderCache()
+
+	// Событие для неизвестного заказа доставляется повторно
+	result, err := ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{
+		Type: models.EventCancelled, OrderUID: "missing", Version: 2,
+	}), false)
+	assert.ErrorIs(err, ErrOrderNotFound)
+	assert.Equal(ResultFailed, result)
+
+	// Событие без нужных данных отправляется в карантин
+	result, err = ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{
+		Type: models.EventItemStatusChanged, OrderUID: "missing", Version: 2,
+	}), false)
+	assert.ErrorIs(err, ErrInvalidOrder)
+	assert.Equal(ResultRejected, result)
+
+	result, err = ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{
+		Type: "deleted", OrderUID: "missing", Version: 2,
+	}), false)
+	assert.ErrorIs(err, ErrInvalidOrder)
+	assert.Equal(ResultRejected, result)
+}
+
+func TestProcessOrderUnknownItem(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	store := history.NewStore(db)
+	orders, err := history.Wrap(repository.NewGormRepository(db), store)
+	require.NoError(t, err)
+	orderCache := cache.NewOrderCache()
+
+	messages, err := tests.GenerateTestMessages(1)
+	require.NoError(t, err)
+	result, err := ProcessOrder(orderCache, orders, &natsclient.Message{Data: []byte(messages[0])}, false)
+	assert.NoError(err)
+	assert.Equal(ResultInserted, result)
+	uid := "b563feb7b2b84b6test0"
+
+	created, err := orders.GetByUID(uid)
+	assert.NoError(err)
+	before, err := store.List(uid)
+	assert.NoError(err)
+
+	// Событие для позиции, которой нет в заказе, отправляется в карантин, а не подтверждается молча
+	result, err = ProcessOrder(orderCache, orders, eventMessage(t, models.OrderEvent{
+		Type: models.EventItemStatusChanged, OrderUID: uid, Version: created.Version + 1,
+		Item: &models.ItemStatusChange{ChrtID: 99, Status: 5},
+	}), false)
+	assert.ErrorIs(err, ErrInvalidOrder)
+	assert.ErrorIs(err, repository.ErrItemNotFound)
+	assert.Equal(ResultRejected, result)
+
+	stored, err := orders.GetByUID(uid)
+	assert.NoError(err)
+	assert.Equal(created.Version, stored.Version)
+	after, err := store.List(uid)
+	assert.NoError(err)
+	assert.Equal(len(before), len(after), "изменение не записывается в историю")
+}
+
+func TestProcessOrderRepositoryError(t *testing.T) {
+	assert := assert.New(t)
+	repo := repository.NewMemoryRepository()
+	orderCache := cache.NewOrderCache()
+	messages, err := tests.GenerateTestMessages(1)
+	assert.NoError(err)
+	message := &natsclient.Message{Data: []byte(messages[0])}
+
+	// Сбой хранилища - временная ошибка, сообщение доставляется повторно, а не уходит в карантин
+	repo.Err = errors.New("connection refused")
+	result, err := ProcessOrder(orderCache, repo, message, false)
+	assert.Equal(ResultFailed, result)
+	assert.Error(err)
+	assert.False(errors.Is(err, ErrInvalidOrder))
+	assert.Equal(0, orderCache.Count())
+
+	repo.Err = nil
+	result, err = ProcessOrder(orderCache, repo, message, false)
+	assert.NoError(err)
+	assert.Equal(ResultInserted, result)
+	assert.Equal(1, orderCache.Count())
+}
+
+func TestProcessOrderConstraintViolation(t *testing.T) {
+	assert := assert.New(t)
+	repo := repository.NewGormRepository(testdb.Open(t))
+	orderCache := cache.NewOrderCache()
+
+	order := models.Order{OrderUID: "a", TrackNumber: "T1", Payment: models.Payment{Transaction: "tx"}}
+	result, err := ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{Type: models.EventCreated, Order: &order}), false)
+	assert.NoError(err)
+	assert.Equal(ResultInserted, result)
+
+	// Повторная доставка не исправит нарушение ограничений, сообщение отправляется в карантин
+	other := models.Order{OrderUID: "b", TrackNumber: "T2", Payment: models.Payment{Transaction: "tx"}}
+	result, err = ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{Type: models.EventCreated, Order: &other}), false)
+	assert.ErrorIs(err, ErrInvalidOrder)
+	assert.ErrorIs(err, repository.ErrDuplicateTransaction)
+	assert.Equal(ResultRejected, result)
+
+	invalid := models.Order{OrderUID: "a", TrackNumber: "T1", Items: []models.Items{{Price: -10}}}
+	result, err = ProcessOrder(orderCache, repo, eventMessage(t, models.OrderEvent{Type: models.EventUpdated, Version: 2, Order: &invalid}), false)
+	assert.ErrorIs(err, ErrInvalidOrder)
+	assert.ErrorIs(err, repository.ErrConstraintViolation)
+	assert.Equal(ResultRejected, result)
+	assert.Equal(1, orderCache.Count())
+}
+
+func TestProcessOrderRecordsHistory(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	store := history.NewStore(db)
+	repo, err := history.Wrap(repository.NewGormRepository(db), store)
+	require.NoError(t, err)
+	orderCache := cache.NewOrderCache()
+
+	order := models.Order{OrderUID: "a", TrackNumber: "T1"}
+	message := eventMessage(t, models.OrderEvent{Type: models.EventCreated, Order: &order})
+	message.Sequence = 41
+	_, err = ProcessOrder(orderCache, repo, message, false)
+	assert.NoError(err)
+	message = eventMessage(t, models.OrderEvent{Type: models.EventCancelled, OrderUID: "a", Version: 2})
+	message.Sequence = 42
+	_, err = ProcessOrder(orderCache, repo, message, false)
+	assert.NoError(err)
+
+	events, err := store.Timeline("a")
+	assert.NoError(err)
+	if assert.Len(events, 2) {
+		assert.Equal("nats:41", events[0].Source)
+		assert.Equal("nats:42", events[1].Source)
+		assert.Equal(history.ActionUpdated, events[1].Action)
+	}
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"encoding/json"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+	"wild_project/src/cache"
+	"wild_project/src/deadletter"
+	"wild_project/src/models"
+	natsclient "wild_project/src/nats"
+	"wild_project/src/repository"
+	"wild_project/src/tests"
+	"wild_project/src/tests/testdb"
+)
+
+// TestIngestionPipeline проверяет путь PublishMessage -> Subscribe -> ProcessNatsMessage -> OrderCache без внешних сервисов
+func TestIngestionPipeline(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	broker := natsclient.NewMemoryBroker()
+	defer broker.Close()
+
+	orderCache := cache.NewOrderCache()
+	dlq := deadletter.NewQueue(db, broker, "orders-dlq", 5)
+	err := broker.Subscribe("orders", NewOrderHandler(orderCache, repo, dlq), natsclient.AckWait(10*time.Millisecond))
+	assert.NoError(err)
+
+	messages, err := tests.GenerateTestMessages(3)
+	assert.NoError(err)
+	for _, message := range messages {
+		assert.NoError(broker.PublishMessage("orders", []byte(message)))
+	}
+	// Повторное сообщение и сообщение, которое невозможно разобрать
+	assert.NoError(broker.PublishMessage("orders", []byte(messages[0])))
+	assert.NoError(broker.PublishMessage("orders", []byte("not a json")))
+
+	assert.Eventually(func() bool {
+		var quarantined int64
+		db.Model(&models.QuarantinedMessage{}).Count(&quarantined)
+		return orderCache.Count() == 3 && quarantined == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var stored int64
+	db.Model(&models.Order{}).Count(&stored)
+	assert.Equal(int64(3), stored)
+
+	order, exists := orderCache.Get("b563feb7b2b84b6test1")
+	assert.True(exists)
+	assert.Equal("WBILMTESTTRACK", order.TrackNumber)
+
+	msgs, err := dlq.List()
+	assert.NoError(err)
+	if assert.Len(msgs, 1) {
+		assert.Equal("not a json", string(msgs[0].Data))
+		assert.Equal(uint64(5), msgs[0].Sequence)
+	}
+}
+
+// TestRestoredOrderMatchesIngested проверяет, что после перезапуска кэш восстанавливает заказ из БД целиком
+func TestRestoredOrderMatchesIngested(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	orderCache := cache.NewOrderCache()
+
+	order := models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery:    models.Delivery{Name: "Test Testov", Phone: "+9720000000", City: "Kiryat Mozkin", Email: "test@gmail.com"},
+		Payment:     models.Payment{Transaction: "b563feb7b2b84b6test", Currency: "USD", Amount: 1817, Bank: "alpha"},
+		Items: []models.Items{
+			{ChrtID: 9934930, RID: "ab4219087a764ae0btest", Name: "Mascaras", Price: 453, Status: 202},
+			{ChrtID: 9934931, RID: "ab4219087a764ae0btest2", Name: "Lipstick", Price: 120, Status: 202},
+		},
+		CustomerID:  "test",
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+	}
+	data, err := json.Marshal(order)
+	assert.NoError(err)
+	assert.NoError(ProcessNatsMessage(orderCache, repo, &natsclient.Message{Data: data, Sequence: 1}))
+	ingested, exists := orderCache.Get(order.OrderUID)
+	assert.True(exists)
+
+	// Новый кэш после перезапуска
+	restartedCache, err := cache.NewBoundedOrderCache(cache.Config{Policy: cache.PolicyLRU, MaxEntries: 10})
+	assert.NoError(err)
+	assert.NoError(restartedCache.LoadFromDB(repo))
+	restored, exists := restartedCache.Get(order.OrderUID)
+	assert.True(exists)
+
+	assert.Equal(orderJSON(t, ingested), orderJSON(t, restored))
+	assert.Equal("Kiryat Mozkin", restored.Delivery.City)
+	assert.Equal("b563feb7b2b84b6test", restored.Payment.Transaction)
+	assert.Len(restored.Items, 2)
+}
+
+// orderJSON сериализует заказ для сравнения без учета монотонных часов и часового пояса в time.Time
+func orderJSON(t *testing.T, order models.Order) string {
+	normalize := func(m *gorm.Model) {
+		m.CreatedAt = m.CreatedAt.UTC().Round(time.Millisecond)
+		m.UpdatedAt = m.UpdatedAt.UTC().Round(time.Millisecond)
+	}
+	normalize(&order.Model)
+	normalize(&order.Delivery.Model)
+	normalize(&order.Payment.Model)
+	for i := range order.Items {
+		normalize(&order.Items[i].Model)
+	}
+	order.DateCreated = order.DateCreated.UTC()
+	data, err := json.Marshal(order)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+// TestProcessOrderRedisCache проверяет прием заказа с общим кэшем в Redis
+func TestProcessOrderRedisCache(t *testing.T) {
+	assert := assert.New(t)
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	server := miniredis.RunT(t)
+	orderCache, err := cache.New(cache.Config{Backend: cache.BackendRedis, RedisURL: "redis://" + server.Addr()})
+	assert.NoError(err)
+
+	messages, err := tests.GenerateTestMessages(2)
+	assert.NoError(err)
+	for i, message := range messages {
+		assert.NoError(ProcessNatsMessage(orderCache, repo, &natsclient.Message{Data: []byte(message), Sequence: uint64(i + 1)}))
+	}
+	result, err := ProcessOrder(orderCache, repo, &natsclient.Message{Data: []byte(messages[0])}, false)
+	assert.NoError(err)
+	assert.Equal(ResultDuplicate, result)
+
+	order, exists := orderCache.Get("b563feb7b2b84b6test1")
+	assert.True(exists)
+	assert.Equal(1818, order.Payment.Amount)
+	assert.Equal(2, orderCache.Count())
+}
+
+func TestProcessNatsMessageClearsMissing(t *testing.T) {
+	db := testdb.Open(t)
+	repo := repository.NewGormRepository(db)
+	server := miniredis.RunT(t)
+	memory, err := cache.New(cache.Config{MissingTTL: time.Minute})
+	assert.NoError(t, err)
+	redis, err := cache.New(cache.Config{Backend: cache.BackendRedis, RedisURL: "redis://" + server.Addr(), MissingTTL: time.Minute})
+	assert.NoError(t, err)
+
+	messages, err := tests.GenerateTestMessages(1)
+	assert.NoError(t, err)
+	uid := "b563feb7b2b84b6test0"
+	for _, orderCache := range []cache.Cache{memory, redis} {
+		orderCache.MarkMissing(uid)
+		assert.True(t, orderCache.Missing(uid))
+		// Сообщение с заказом снимает отметку, даже если заказ уже сохранен в БД
+		assert.NoError(t, ProcessNatsMessage(orderCache, repo, &natsclient.Message{Data: []byte(messages[0]), Sequence: 1}))
+		assert.False(t, orderCache.Missing(uid))
+	}
+}